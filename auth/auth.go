@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/models"
+)
+
+// 权限范围，ScopeAdmin 包含所有权限
+const (
+	ScopeAdmin        = "admin"
+	ScopeImagesWrite  = "images:write"
+	ScopeImagesDelete = "images:delete"
+	ScopeHeartbeat    = "heartbeat"
+	ScopeAdminJobs    = "admin:jobs"
+	ScopeStatsRead    = "stats:read"
+)
+
+// Scopes 所有可以分配给密钥的权限范围
+var Scopes = []string{ScopeAdmin, ScopeImagesWrite, ScopeImagesDelete, ScopeHeartbeat, ScopeAdminJobs, ScopeStatsRead}
+
+const (
+	// 令牌格式：bak_<ID>_<secret>，ID 为十六进制，用于查找记录，secret 只保存哈希
+	tokenPrefix = "bak_"
+	// keyIDLength ID 的字节数，编码后为两倍长度的十六进制
+	keyIDLength = 6
+	// lastUsedInterval 最近使用时间的更新间隔，避免每个请求都写数据库
+	lastUsedInterval = time.Minute
+)
+
+// 通过环境变量配置的旧令牌，分别拥有全部权限和心跳权限
+const (
+	EnvAdminKeyID     = "env:ADMIN_TOKEN"
+	EnvHeartbeatKeyID = "env:TOKEN"
+)
+
+var (
+	// ErrInvalidToken 令牌不存在、格式错误、已过期或已撤销
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrNotFound 密钥不存在
+	ErrNotFound = errors.New("api key not found")
+)
+
+// Principal 通过认证的调用方
+type Principal struct {
+	KeyID  string
+	Name   string
+	Scopes []string
+}
+
+// HasScope 判断是否拥有指定权限，admin 拥有所有权限
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidScope 判断权限范围名称是否有效
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// secretEqual 以恒定时间比较两个字符串，比较前先取哈希以免泄露长度
+func secretEqual(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// BearerToken 从 Authorization 请求头中取出令牌
+func BearerToken(header string) string {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// validKeyID 判断是否为 Create 生成的 ID，其他内容不会被查询或写入日志
+func validKeyID(id string) bool {
+	if len(id) != keyIDLength*2 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// Authenticate 校验令牌，返回调用方信息
+//
+// 除数据库中的密钥外，ADMIN_TOKEN 和 TOKEN 环境变量仍然有效，便于平滑迁移
+func Authenticate(ctx context.Context, token string) (Principal, error) {
+	if token == "" {
+		return Principal{}, ErrInvalidToken
+	}
+
+	if admin := os.Getenv("ADMIN_TOKEN"); admin != "" && secretEqual(token, admin) {
+		return Principal{KeyID: EnvAdminKeyID, Name: "ADMIN_TOKEN", Scopes: []string{ScopeAdmin}}, nil
+	}
+	if heartbeat := os.Getenv("TOKEN"); heartbeat != "" && secretEqual(token, heartbeat) {
+		return Principal{KeyID: EnvHeartbeatKeyID, Name: "TOKEN", Scopes: []string{ScopeHeartbeat}}, nil
+	}
+
+	rest, ok := strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return Principal{}, ErrInvalidToken
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || !validKeyID(id) || secret == "" {
+		return Principal{}, ErrInvalidToken
+	}
+
+	var key models.APIKey
+	err := models.APIKeysCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return Principal{KeyID: id}, ErrInvalidToken
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+
+	now := time.Now()
+	if !secretEqual(hashSecret(secret), key.SecretHash) ||
+		key.RevokedAt != nil ||
+		(key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return Principal{KeyID: id}, ErrInvalidToken
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedInterval {
+		_, _ = models.APIKeysCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lastUsedAt": now}})
+	}
+	return Principal{KeyID: key.ID, Name: key.Name, Scopes: key.Scopes}, nil
+}
+
+// Create 创建密钥，返回的令牌只在创建时可见
+func Create(ctx context.Context, name string, scopes []string, expiresAt *time.Time) (models.APIKey, string, error) {
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return models.APIKey{}, "", fmt.Errorf("invalid scope: %s", scope)
+		}
+	}
+
+	idBytes := make([]byte, keyIDLength)
+	_, _ = rand.Read(idBytes)
+	id := hex.EncodeToString(idBytes)
+	secret := randomString(32)
+	key := models.APIKey{
+		ID:         id,
+		Name:       name,
+		SecretHash: hashSecret(secret),
+		Scopes:     scopes,
+		CreatedAt:  time.Now(),
+		ExpiresAt:  expiresAt,
+	}
+	if _, err := models.APIKeysCollection.InsertOne(ctx, key); err != nil {
+		return models.APIKey{}, "", err
+	}
+	return key, tokenPrefix + id + "_" + secret, nil
+}
+
+// List 按创建时间倒序列出密钥，includeRevoked 为 false 时不包含已撤销的密钥
+func List(ctx context.Context, includeRevoked bool) ([]models.APIKey, error) {
+	filter := bson.M{}
+	if !includeRevoked {
+		filter["revokedAt"] = bson.M{"$exists": false}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := models.APIKeysCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	keys := []models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke 撤销密钥，撤销后立即失效，记录保留用于审计
+func Revoke(ctx context.Context, id string) (models.APIKey, error) {
+	var key models.APIKey
+	err := models.APIKeysCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return key, ErrNotFound
+	}
+	return key, err
+}
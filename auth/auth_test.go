@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/models"
+)
+
+func TestAuthenticateEnvTokens(t *testing.T) {
+	testutil.SetSecrets(t)
+	ctx := context.Background()
+
+	admin, err := Authenticate(ctx, testutil.AdminToken)
+	if err != nil || admin.KeyID != EnvAdminKeyID || !admin.HasScope(ScopeImagesDelete) {
+		t.Errorf("ADMIN_TOKEN: %+v, %v", admin, err)
+	}
+	heartbeat, err := Authenticate(ctx, testutil.Token)
+	if err != nil || heartbeat.KeyID != EnvHeartbeatKeyID || !heartbeat.HasScope(ScopeHeartbeat) || heartbeat.HasScope(ScopeImagesWrite) {
+		t.Errorf("TOKEN: %+v, %v", heartbeat, err)
+	}
+
+	// 格式不对的令牌不会查询数据库
+	for _, token := range []string{"", "Bearer x", "bak_", "bak_nothex_secret", "bak_0123456789ab_", testutil.SteamAPIKey} {
+		if _, err := Authenticate(ctx, token); err != ErrInvalidToken {
+			t.Errorf("Authenticate(%q) = %v, want ErrInvalidToken", token, err)
+		}
+	}
+}
+
+func TestScopedKeyLifecycle(t *testing.T) {
+	testutil.SetupDB(t)
+	ctx := context.Background()
+
+	if _, _, err := Create(ctx, "bad", []string{"images:everything"}, nil); err == nil {
+		t.Fatal("Create accepted an invalid scope")
+	}
+
+	key, token, err := Create(ctx, "uploader", []string{ScopeImagesWrite}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err := Authenticate(ctx, token)
+	if err != nil || principal.KeyID != key.ID || principal.Name != "uploader" {
+		t.Fatalf("Authenticate = %+v, %v", principal, err)
+	}
+	if !principal.HasScope(ScopeImagesWrite) || principal.HasScope(ScopeImagesDelete) || principal.HasScope(ScopeAdmin) {
+		t.Errorf("scopes = %v", principal.Scopes)
+	}
+	var stored models.APIKey
+	if err := models.APIKeysCollection.FindOne(ctx, bson.M{"_id": key.ID}).Decode(&stored); err != nil || stored.LastUsedAt == nil {
+		t.Errorf("lastUsedAt not recorded: %+v, %v", stored, err)
+	}
+	if stored.SecretHash == "" || stored.SecretHash == token {
+		t.Errorf("secret stored in plain text")
+	}
+
+	// 正确的 ID 配错误的 secret
+	if _, err := Authenticate(ctx, token+"x"); err != ErrInvalidToken {
+		t.Errorf("wrong secret: %v, want ErrInvalidToken", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	_, expired, err := Create(ctx, "expired", []string{ScopeAdmin}, &past)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Authenticate(ctx, expired); err != ErrInvalidToken {
+		t.Errorf("expired key: %v, want ErrInvalidToken", err)
+	}
+
+	if _, err := Revoke(ctx, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Authenticate(ctx, token); err != ErrInvalidToken {
+		t.Errorf("revoked key: %v, want ErrInvalidToken", err)
+	}
+	if _, err := Revoke(ctx, key.ID); err != ErrNotFound {
+		t.Errorf("revoke twice: %v, want ErrNotFound", err)
+	}
+
+	active, err := List(ctx, false)
+	if err != nil || len(active) != 1 || active[0].Name != "expired" {
+		t.Errorf("List(false) = %+v, %v", active, err)
+	}
+	all, err := List(ctx, true)
+	if err != nil || len(all) != 2 {
+		t.Errorf("List(true) returned %d keys, %v", len(all), err)
+	}
+}
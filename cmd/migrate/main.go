@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -17,14 +22,16 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+	"pysio.online/blog_api/utils"
 )
 
 type Image struct {
 	Hash        string    `bson:"hash"`
-	Data        []byte    `bson:"data,omitempty"`
 	ContentType string    `bson:"contentType"`
 	CreatedAt   time.Time `bson:"createdAt"`
-	UseS3       bool      `bson:"useS3"`
+	Size        int64     `bson:"size"`
 }
 
 type Stats struct {
@@ -44,33 +51,118 @@ func (s *Stats) Increment(field *int64) {
 	s.Unlock()
 }
 
-const (
-	workerCount        = 20         // 增加到20个并发
-	minFileSize        = 100 * 1024 // 最小文件大小（100KB）
-	migrationBatchSize = 100        // 每批处理的文件数
+// Checkpoint 记录已完成的最后一批图片，中断后按 hash 顺序从这里继续
+type Checkpoint struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	LastHash  string    `json:"lastHash"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// 支持的迁移方向
+var directions = map[string]bool{
+	storage.BackendMongo + ">" + storage.BackendS3: true,
+	storage.BackendS3 + ">" + storage.BackendMongo: true,
+	storage.BackendS3 + ">" + storage.BackendLocal: true,
+	storage.BackendLocal + ">" + storage.BackendS3: true,
+}
+
+var (
+	from           string
+	to             string
+	concurrency    int
+	batchSize      int
+	dryRun         bool
+	keepSource     bool
+	checkpointPath string
+	restart        bool
+	localDir       string
+	cleanupSmall   bool
+	minFileSize    int64
 )
 
+func parseFlags() {
+	var minSize string
+	flag.StringVar(&from, "from", storage.BackendMongo, "源存储后端（mongo、s3、local）")
+	flag.StringVar(&to, "to", storage.BackendS3, "目标存储后端（mongo、s3、local）")
+	flag.IntVar(&concurrency, "concurrency", 20, "并发迁移数量")
+	flag.IntVar(&batchSize, "batch-size", 100, "每批处理的图片数，每批完成后写入检查点")
+	flag.BoolVar(&dryRun, "dry-run", false, "只列出需要迁移的图片，不做任何修改")
+	flag.BoolVar(&keepSource, "keep-source", false, "迁移后保留源存储中的数据")
+	flag.StringVar(&checkpointPath, "checkpoint", "", "检查点文件路径，默认 .migrate-<from>-<to>.json")
+	flag.BoolVar(&restart, "restart", false, "忽略已有的检查点，从头开始")
+	flag.StringVar(&localDir, "local-dir", os.Getenv("LOCAL_STORAGE_DIR"), "本地存储目录，默认 ./data/images")
+	flag.BoolVar(&cleanupSmall, "cleanup-small-files", false, "删除 S3 中小于 -min-size 的图片及其记录（不可恢复）")
+	flag.StringVar(&minSize, "min-size", "100K", "-cleanup-small-files 使用的大小阈值")
+	flag.Parse()
+
+	if !directions[from+">"+to] {
+		log.Fatalf("Unsupported direction %s -> %s, supported: mongo->s3, s3->mongo, s3->local, local->s3", from, to)
+	}
+	if concurrency < 1 || batchSize < 1 {
+		log.Fatalf("-concurrency and -batch-size must be positive")
+	}
+	size, err := utils.ParseByteSize(minSize)
+	if err != nil {
+		log.Fatalf("Invalid -min-size: %v", err)
+	}
+	minFileSize = size
+	if checkpointPath == "" {
+		checkpointPath = fmt.Sprintf(".migrate-%s-%s.json", from, to)
+	}
+}
+
 func main() {
+	// 日志中不输出密钥等机密值
+	log.SetOutput(utils.NewRedactingWriter(os.Stderr))
+
 	// 加载 .env 文件
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("Error loading .env file")
 	}
 
-	ctx := context.Background()
-	mongoClient, minioClient, collection := initClients(ctx)
-	defer mongoClient.Disconnect(ctx)
+	// migrate verify [flags] 检查图片记录与存储对象是否一致
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(runVerify(os.Args[2:]))
+	}
+	parseFlags()
 
-	// 测试 Minio 连接
-	testMinioConnection(ctx, minioClient)
+	// 收到中断信号时停止派发新的批次，已完成的批次记录在检查点中
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// 执行迁移
-	stats := migrateImages(ctx, collection, minioClient)
+	mongoClient, minioClient, collection := initClients(ctx)
+	defer mongoClient.Disconnect(context.Background())
 
-	// 检查并清理小文件
-	cleanupSmallFiles(ctx, collection, minioClient, stats)
+	// 测试 Minio 连接（会写入测试文件，dry-run 时跳过）
+	if !dryRun {
+		prepareBucket(ctx, minioClient)
+		testMinioConnection(ctx, minioClient)
+	}
+
+	stores := map[string]storage.ImageStore{
+		storage.BackendMongo: storage.NewMongoStore(collection),
+		storage.BackendS3:    storage.NewMinioStore(minioClient, os.Getenv("MINIO_BUCKET")),
+	}
+	if from == storage.BackendLocal || to == storage.BackendLocal {
+		local, err := storage.NewLocalStore(localDir)
+		if err != nil {
+			log.Fatalf("Failed to initialize local storage: %v", err)
+		}
+		stores[storage.BackendLocal] = local
+	}
 
-	// 清理无效记录
-	cleanupInvalidRecords(ctx, collection, minioClient, stats)
+	// 执行迁移
+	stats := migrateImages(ctx, collection, stores[from], stores[to])
+
+	// 破坏性的清理操作需要显式开启
+	if cleanupSmall {
+		if dryRun {
+			log.Println("Skipping cleanup in dry-run mode")
+		} else if ctx.Err() == nil {
+			cleanupSmallFiles(ctx, collection, stores[storage.BackendS3], stats)
+		}
+	}
 
 	// 打印最终统计信息
 	printStats(stats)
@@ -124,7 +216,18 @@ func initClients(ctx context.Context) (*mongo.Client, *minio.Client, *mongo.Coll
 		log.Fatalf("Failed to initialize Minio client: %v", err)
 	}
 
-	// 测试 Minio 连接并确保存储桶存在
+	dbName := os.Getenv("MONGODB_DB_NAME")
+	if dbName == "" {
+		dbName = "image-store"
+	}
+	return mongoClient, minioClient, mongoClient.Database(dbName).Collection("images")
+}
+
+// prepareBucket 确保存储桶存在并测试写入权限，只在需要写入 Minio 时调用
+func prepareBucket(ctx context.Context, minioClient *minio.Client) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
 	bucketName := os.Getenv("MINIO_BUCKET")
 	exists, err := minioClient.BucketExists(ctx, bucketName)
 	if err != nil {
@@ -132,7 +235,7 @@ func initClients(ctx context.Context) (*mongo.Client, *minio.Client, *mongo.Coll
 		log.Printf("Minio endpoint: %s", os.Getenv("MINIO_ENDPOINT"))
 		log.Printf("Bucket name: %s", bucketName)
 		log.Printf("SSL enabled: %v", os.Getenv("MINIO_USE_SSL") == "true")
-		log.Printf("Access key: %s", os.Getenv("MINIO_ACCESS_KEY"))
+		log.Printf("Access key: %s", utils.RedactedEnv("MINIO_ACCESS_KEY"))
 		log.Printf("Region: %s", os.Getenv("MINIO_REGION"))
 		log.Fatalf("Please check your Minio configuration")
 	}
@@ -203,8 +306,6 @@ func initClients(ctx context.Context) (*mongo.Client, *minio.Client, *mongo.Coll
 		}
 		log.Printf("Successfully tested bucket write permissions")
 	}
-
-	return mongoClient, minioClient, mongoClient.Database("image-store").Collection("images")
 }
 
 func testMinioConnection(ctx context.Context, minioClient *minio.Client) {
@@ -228,28 +329,64 @@ func testMinioConnection(ctx context.Context, minioClient *minio.Client) {
 	log.Println("Minio connection test passed successfully")
 }
 
-func migrateImages(ctx context.Context, collection *mongo.Collection, minioClient *minio.Client) *Stats {
+func loadCheckpoint() (string, error) {
+	if restart {
+		return "", nil
+	}
+	raw, err := os.ReadFile(checkpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(raw, &cp); err != nil {
+		return "", fmt.Errorf("invalid checkpoint file %s: %v", checkpointPath, err)
+	}
+	if cp.From != from || cp.To != to {
+		return "", fmt.Errorf("checkpoint %s is for %s -> %s, use -restart or -checkpoint", checkpointPath, cp.From, cp.To)
+	}
+	return cp.LastHash, nil
+}
+
+// saveCheckpoint 先写临时文件再重命名，避免中断时留下不完整的检查点
+func saveCheckpoint(lastHash string) error {
+	raw, err := json.MarshalIndent(Checkpoint{From: from, To: to, LastHash: lastHash, UpdatedAt: time.Now()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := checkpointPath + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, checkpointPath)
+}
+
+func migrateImages(ctx context.Context, collection *mongo.Collection, source, dest storage.ImageStore) *Stats {
 	stats := &Stats{}
+	log.Printf("Migrating images: %s -> %s (concurrency=%d, batch-size=%d, dry-run=%v)",
+		source.Name(), dest.Name(), concurrency, batchSize, dryRun)
 
-	// 只获取需要迁移的文件
-	filter := bson.M{
-		"$or": []bson.M{
-			{"useS3": false},
-			{"useS3": bson.M{"$exists": false}},
-		},
-		"data": bson.M{"$ne": nil},
+	lastHash, err := loadCheckpoint()
+	if err != nil {
+		log.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	if lastHash != "" {
+		log.Printf("Resuming from checkpoint %s after %s", checkpointPath, lastHash)
 	}
 
-	// 使用投影只获取必要的字段
-	opts := options.Find().SetProjection(bson.M{
-		"hash":        1,
-		"data":        1,
-		"contentType": 1,
-		"useS3":       1,
-	})
+	// 按 hash 顺序分批处理，检查点只需记录最后一个 hash
+	filter := func() bson.M {
+		f := models.StorageFilter(source.Name())
+		if lastHash != "" {
+			f = bson.M{"$and": bson.A{f, bson.M{"hash": bson.M{"$gt": lastHash}}}}
+		}
+		return f
+	}
 
 	// 获取总数
-	total, err := collection.CountDocuments(ctx, filter)
+	total, err := collection.CountDocuments(ctx, filter())
 	if err != nil {
 		log.Printf("Failed to get total documents: %v", err)
 	} else {
@@ -262,337 +399,169 @@ func migrateImages(ctx context.Context, collection *mongo.Collection, minioClien
 		return stats
 	}
 
-	// 创建工作通道，增加缓冲区大小
-	imageChan := make(chan Image, workerCount*4)
-	var wg sync.WaitGroup
-
-	// 启动工作线程
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go worker(ctx, collection, minioClient, imageChan, stats, &wg)
-	}
-
-	// 启动进度报告协程
-	done := make(chan bool)
-	go func() {
-		ticker := time.NewTicker(5 * time.Second)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-done:
-				return
-			case <-ticker.C:
-				processed := stats.Migrated + stats.Skipped + stats.Failed + stats.NoContent
-				percentage := float64(processed) / float64(total) * 100
-				log.Printf("Progress: %.2f%% (Processed=%d/%d, Migrated=%d, Skipped=%d, Failed=%d, NoContent=%d)",
-					percentage, processed, total, stats.Migrated, stats.Skipped, stats.Failed, stats.NoContent)
-			}
-		}
-	}()
+	opts := options.Find().
+		SetProjection(bson.M{"hash": 1, "contentType": 1, "createdAt": 1, "size": 1}).
+		SetSort(bson.D{{Key: "hash", Value: 1}}).
+		SetLimit(int64(batchSize))
 
-	// 获取所有图片
-	cursor, err := collection.Find(ctx, filter, opts)
-	if err != nil {
-		log.Fatalf("Failed to query images: %v", err)
-	}
-	defer cursor.Close(ctx)
-
-	// 发送图片到工作通道
-	for cursor.Next(ctx) {
-		stats.Increment(&stats.Total)
-		var image Image
-		if err := cursor.Decode(&image); err != nil {
-			log.Printf("Failed to decode image: %v", err)
-			stats.Increment(&stats.Failed)
-			continue
+	for ctx.Err() == nil {
+		cursor, err := collection.Find(ctx, filter(), opts)
+		if err != nil {
+			log.Printf("Failed to query images: %v", err)
+			break
 		}
-		imageChan <- image
-	}
-
-	// 关闭通道并等待所有工作线程完成
-	close(imageChan)
-	wg.Wait()
-	close(done) // 停止进度报告
-
-	return stats
-}
-
-func worker(ctx context.Context, collection *mongo.Collection, minioClient *minio.Client, imageChan <-chan Image, stats *Stats, wg *sync.WaitGroup) {
-	defer wg.Done()
-	bucketName := os.Getenv("MINIO_BUCKET")
-
-	// 每个 worker 独立计数
-	var localTotal, localMigrated int64
-
-	// 批量处理的缓冲区
-	var batch []Image
-	batchSize := 0
-
-	processBatch := func(images []Image) {
-		if len(images) == 0 {
-			return
+		var batch []Image
+		if err := cursor.All(ctx, &batch); err != nil {
+			log.Printf("Failed to decode images: %v", err)
+			break
 		}
-
-		for _, image := range images {
-			// 上传到 Minio
-			reader := bytes.NewReader(image.Data)
-			info, err := minioClient.PutObject(ctx, bucketName, image.Hash+".webp", reader, int64(len(image.Data)),
-				minio.PutObjectOptions{ContentType: "image/webp"})
-			if err != nil {
-				log.Printf("Worker: Failed to upload %s to Minio: %v", image.Hash, err)
-				log.Printf("Details: size=%d, bucket=%s, content-type=%s", len(image.Data), bucketName, "image/webp")
-				if minioErr, ok := err.(minio.ErrorResponse); ok {
-					log.Printf("Minio error details: code=%s, message=%s, requestid=%s",
-						minioErr.Code, minioErr.Message, minioErr.RequestID)
-				}
-				stats.Increment(&stats.Failed)
-				continue
-			}
-			log.Printf("Successfully uploaded %s (size: %d)", image.Hash, info.Size)
-
-			// 更新数据库记录
-			_, err = collection.UpdateOne(ctx, bson.M{"hash": image.Hash}, bson.M{
-				"$set": bson.M{
-					"useS3": true,
-					"data":  nil,
-				},
-			})
-			if err != nil {
-				log.Printf("Worker: Failed to update MongoDB record for %s: %v", image.Hash, err)
-				_ = minioClient.RemoveObject(ctx, bucketName, image.Hash+".webp", minio.RemoveObjectOptions{})
-				stats.Increment(&stats.Failed)
-				continue
-			}
-
-			localMigrated++
-			stats.Increment(&stats.Migrated)
+		if len(batch) == 0 {
+			break
 		}
-	}
 
-	for image := range imageChan {
-		localTotal++
-
-		if image.UseS3 {
-			stats.Increment(&stats.Skipped)
-			continue
+		// 批次内并发处理
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for _, image := range batch {
+			stats.Increment(&stats.Total)
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(image Image) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				migrateImage(ctx, collection, source, dest, image, stats)
+			}(image)
 		}
+		wg.Wait()
 
-		if len(image.Data) == 0 {
-			stats.Increment(&stats.NoContent)
-			continue
+		// 批次中途被中断时不推进检查点，下次从这一批重新开始
+		if ctx.Err() != nil {
+			break
 		}
-
-		batch = append(batch, image)
-		batchSize++
-
-		if batchSize >= migrationBatchSize {
-			processBatch(batch)
-			batch = batch[:0]
-			batchSize = 0
-			log.Printf("Worker progress: Processed %d, Migrated %d", localTotal, localMigrated)
+		lastHash = batch[len(batch)-1].Hash
+		if !dryRun {
+			if err := saveCheckpoint(lastHash); err != nil {
+				log.Printf("Failed to save checkpoint: %v", err)
+			}
 		}
-	}
-
-	// 处理剩余的批次
-	processBatch(batch)
-}
-
-func cleanupSmallFiles(ctx context.Context, collection *mongo.Collection, minioClient *minio.Client, stats *Stats) {
-	log.Println("\nStarting small files cleanup...")
-	bucketName := os.Getenv("MINIO_BUCKET")
-
-	// 获取所有使用 S3 的图片
-	cursor, err := collection.Find(ctx, bson.M{"useS3": true})
-	if err != nil {
-		log.Printf("Failed to query S3 images: %v", err)
-		return
-	}
-	defer cursor.Close(ctx)
 
-	var wg sync.WaitGroup
-	fileChan := make(chan string, workerCount)
+		processed := stats.Migrated + stats.Skipped + stats.Failed + stats.NoContent
+		log.Printf("Progress: %.2f%% (Processed=%d/%d, Migrated=%d, Skipped=%d, Failed=%d, NoContent=%d)",
+			float64(processed)/float64(total)*100, processed, total,
+			stats.Migrated, stats.Skipped, stats.Failed, stats.NoContent)
 
-	// 创建 HTTP 客户端
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-			MaxIdleConns:       100,
-			IdleConnTimeout:    90 * time.Second,
-			DisableCompression: true,
-		},
+		if len(batch) < batchSize {
+			break
+		}
 	}
 
-	// 启动清理工作线程
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for hash := range fileChan {
-				// 构建公共 URL
-				url := fmt.Sprintf("https://%s/%s/%s.webp",
-					os.Getenv("MINIO_ENDPOINT"),
-					bucketName,
-					hash)
-
-				// 发送 HEAD 请求获取文件大小
-				resp, err := httpClient.Head(url)
-				if err != nil {
-					log.Printf("Failed to get file info for %s: %v", hash, err)
-					continue
-				}
-				resp.Body.Close()
-
-				// 获取文件大小
-				size := resp.ContentLength
-				if size < minFileSize {
-					log.Printf("Small file found: %s (size: %d bytes)", hash, size)
-
-					// 删除 Minio 中的文件
-					err = minioClient.RemoveObject(ctx, bucketName, hash+".webp", minio.RemoveObjectOptions{})
-					if err != nil {
-						log.Printf("Failed to delete small file %s from Minio: %v", hash, err)
-						continue
-					}
-
-					// 更新数据库记录
-					_, err = collection.UpdateOne(ctx, bson.M{"hash": hash}, bson.M{
-						"$set": bson.M{"useS3": false},
-					})
-					if err != nil {
-						log.Printf("Failed to update MongoDB record for deleted file %s: %v", hash, err)
-						continue
-					}
-
-					stats.Increment(&stats.Deleted)
-					log.Printf("Deleted small file: %s", hash)
-				}
-			}
-		}()
+	if ctx.Err() != nil {
+		log.Printf("Interrupted, run the same command again to resume from %s", checkpointPath)
+		return stats
 	}
-
-	// 发送文件到清理通道
-	for cursor.Next(ctx) {
-		var image Image
-		if err := cursor.Decode(&image); err != nil {
-			log.Printf("Failed to decode image during cleanup: %v", err)
-			continue
+	if !dryRun {
+		// 全部完成后删除检查点，失败的图片可以重新运行迁移重试
+		if err := os.Remove(checkpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to remove checkpoint: %v", err)
 		}
-		fileChan <- image.Hash
 	}
-
-	close(fileChan)
-	wg.Wait()
+	return stats
 }
 
-func cleanupInvalidRecords(ctx context.Context, collection *mongo.Collection, minioClient *minio.Client, stats *Stats) {
-	log.Println("\nStarting invalid records cleanup...")
-	bucketName := os.Getenv("MINIO_BUCKET")
+// migrateImage 复制到目标后端并更新记录，成功后删除源数据（-keep-source 时保留）
+func migrateImage(ctx context.Context, collection *mongo.Collection, source, dest storage.ImageStore, image Image, stats *Stats) {
+	if dryRun {
+		log.Printf("[dry-run] Would migrate %s (size: %d)", image.Hash, image.Size)
+		stats.Increment(&stats.Migrated)
+		return
+	}
 
-	// 获取所有标记为 useS3=true 的记录
-	cursor, err := collection.Find(ctx, bson.M{"useS3": true})
+	data, err := source.Get(ctx, image.Hash)
+	if err == storage.ErrNotFound {
+		log.Printf("No content for %s in %s storage", image.Hash, source.Name())
+		stats.Increment(&stats.NoContent)
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to query S3 images: %v", err)
+		log.Printf("Failed to read %s from %s storage: %v", image.Hash, source.Name(), err)
+		stats.Increment(&stats.Failed)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var wg sync.WaitGroup
-	type checkItem struct {
-		hash string
-		id   interface{}
+	contentType := image.ContentType
+	if contentType == "" {
+		contentType = "image/webp"
+	}
+	if err := dest.Put(ctx, image.Hash, data, contentType); err != nil {
+		log.Printf("Failed to write %s to %s storage: %v", image.Hash, dest.Name(), err)
+		stats.Increment(&stats.Failed)
+		return
 	}
-	itemChan := make(chan checkItem, workerCount)
 
-	// 创建 HTTP 客户端
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-			MaxIdleConns:       100,
-			IdleConnTimeout:    90 * time.Second,
-			DisableCompression: true,
+	// 更新数据库记录
+	_, err = collection.UpdateOne(ctx, bson.M{"hash": image.Hash}, bson.M{
+		"$set": bson.M{
+			"storage": dest.Name(),
+			"useS3":   dest.Name() == storage.BackendS3,
 		},
+	})
+	if err != nil {
+		log.Printf("Failed to update MongoDB record for %s: %v", image.Hash, err)
+		_ = dest.Delete(context.Background(), image.Hash)
+		stats.Increment(&stats.Failed)
+		return
 	}
 
-	// 启动检查线程
-	for i := 0; i < workerCount; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for item := range itemChan {
-				// 构建公共 URL
-				url := fmt.Sprintf("https://%s/%s/%s.webp",
-					os.Getenv("MINIO_ENDPOINT"),
-					bucketName,
-					item.hash)
-
-				// 发送 HEAD 请求检查文件是否存在
-				resp, err := httpClient.Head(url)
-				if err != nil || resp.StatusCode == http.StatusNotFound {
-					if resp != nil {
-						resp.Body.Close()
-					}
-					// 文件不存在，删除数据库记录
-					log.Printf("File not found in Minio: %s, removing database record", item.hash)
-					_, err := collection.DeleteOne(ctx, bson.M{"_id": item.id})
-					if err != nil {
-						log.Printf("Failed to delete invalid record for %s: %v", item.hash, err)
-					} else {
-						stats.Increment(&stats.Deleted)
-						log.Printf("Deleted invalid record: %s", item.hash)
-					}
-					continue
-				}
-				resp.Body.Close()
-			}
-		}()
+	if !keepSource {
+		if err := source.Delete(ctx, image.Hash); err != nil {
+			log.Printf("Warning: Failed to delete %s from %s storage: %v", image.Hash, source.Name(), err)
+		}
 	}
+	stats.Increment(&stats.Migrated)
+}
+
+// cleanupSmallFiles 删除 S3 中小于 minFileSize 的图片及其记录
+func cleanupSmallFiles(ctx context.Context, collection *mongo.Collection, s3 storage.ImageStore, stats *Stats) {
+	log.Printf("\nStarting small files cleanup (min size: %d bytes)...", minFileSize)
 
-	// 发送记录到检查通道
-	var invalidCount int64
-	for cursor.Next(ctx) {
-		var image struct {
-			ID   interface{} `bson:"_id"`
-			Hash string      `bson:"hash"`
+	err := s3.List(ctx, func(info storage.ObjectInfo) error {
+		if info.Size >= minFileSize {
+			return nil
 		}
-		if err := cursor.Decode(&image); err != nil {
-			log.Printf("Failed to decode image during cleanup: %v", err)
-			continue
+		log.Printf("Small file found: %s (size: %d bytes)", info.Hash, info.Size)
+
+		// 删除 Minio 中的文件
+		if err := s3.Delete(ctx, info.Hash); err != nil {
+			log.Printf("Failed to delete small file %s from Minio: %v", info.Hash, err)
+			return nil
 		}
-		itemChan <- checkItem{hash: image.Hash, id: image.ID}
-		invalidCount++
-	}
 
-	close(itemChan)
-	wg.Wait()
+		// 删除数据库记录
+		_, err := collection.DeleteOne(ctx, bson.M{"$and": bson.A{
+			bson.M{"hash": info.Hash}, models.StorageFilter(storage.BackendS3),
+		}})
+		if err != nil {
+			log.Printf("Failed to delete MongoDB record for small file %s: %v", info.Hash, err)
+			return nil
+		}
 
-	// 删除所有失败的记录
-	result, err := collection.DeleteMany(ctx, bson.M{
-		"useS3": false,
-		"data":  nil,
+		stats.Increment(&stats.Deleted)
+		log.Printf("Deleted small file: %s", info.Hash)
+		return nil
 	})
 	if err != nil {
-		log.Printf("Failed to delete failed records: %v", err)
-	} else {
-		log.Printf("Deleted %d failed records", result.DeletedCount)
-		stats.Increment(&stats.Deleted)
+		log.Printf("Failed to list S3 objects: %v", err)
 	}
-
-	log.Printf("Invalid records cleanup completed. Processed %d records", invalidCount)
 }
 
 func printStats(stats *Stats) {
-	fmt.Printf("\nMigration and cleanup completed:\n")
+	fmt.Printf("\nMigration completed: %s -> %s\n", from, to)
+	if dryRun {
+		fmt.Printf("Dry run, nothing was changed\n")
+	}
 	fmt.Printf("Total processed: %d\n", stats.Total)
 	fmt.Printf("Successfully migrated: %d\n", stats.Migrated)
-	fmt.Printf("Skipped (already in S3): %d\n", stats.Skipped)
 	fmt.Printf("No content: %d\n", stats.NoContent)
 	fmt.Printf("Failed: %d\n", stats.Failed)
-	fmt.Printf("Small files deleted: %d\n", stats.Deleted)
-	fmt.Printf("Invalid records removed: %d\n", stats.Invalid)
+	fmt.Printf("Deleted by cleanup: %d\n", stats.Deleted)
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+)
+
+// setMigrateFlags 设置迁移使用的命令行参数，检查点写入临时目录
+func setMigrateFlags(t *testing.T, source, dest string) {
+	t.Helper()
+	from, to = source, dest
+	concurrency, batchSize = 2, 2
+	dryRun, keepSource, restart = false, false, false
+	checkpointPath = filepath.Join(t.TempDir(), "checkpoint.json")
+}
+
+// insertMongoImages 插入数据保存在 MongoDB 中的图片，返回按顺序排列的 hash
+func insertMongoImages(t *testing.T, n int) []string {
+	t.Helper()
+	ctx := context.Background()
+	store := storage.NewMongoStore(models.ImagesCollection)
+	var hashes []string
+	for i := 0; i < n; i++ {
+		data := []byte(fmt.Sprintf("image data %d", i))
+		hash := fmt.Sprintf("%x", md5.Sum(data))
+		image := models.Image{Hash: hash, Storage: storage.BackendMongo, CreatedAt: time.Now(), Size: int64(len(data))}
+		if _, err := models.ImagesCollection.InsertOne(ctx, image); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Put(ctx, hash, data, "image/webp"); err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+func TestLoadCheckpointRejectsOtherDirection(t *testing.T) {
+	setMigrateFlags(t, storage.BackendMongo, storage.BackendS3)
+	if err := saveCheckpoint("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if last, err := loadCheckpoint(); err != nil || last != "abc" {
+		t.Fatalf("loadCheckpoint = %q, %v", last, err)
+	}
+
+	from, to = storage.BackendS3, storage.BackendMongo
+	if _, err := loadCheckpoint(); err == nil {
+		t.Error("loadCheckpoint accepted a checkpoint for another direction")
+	}
+	restart = true
+	if last, err := loadCheckpoint(); err != nil || last != "" {
+		t.Errorf("loadCheckpoint with -restart = %q, %v", last, err)
+	}
+}
+
+func TestMigrateImagesResumesFromCheckpoint(t *testing.T) {
+	testutil.SetupDB(t)
+	ctx := context.Background()
+	setMigrateFlags(t, storage.BackendMongo, storage.BackendLocal)
+	source := storage.NewMongoStore(models.ImagesCollection)
+	dest, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := insertMongoImages(t, 5)
+
+	// 模拟前两张已在上次运行中处理完
+	if err := saveCheckpoint(hashes[1]); err != nil {
+		t.Fatal(err)
+	}
+	stats := migrateImages(ctx, models.ImagesCollection, source, dest)
+	if stats.Total != 3 || stats.Migrated != 3 || stats.Failed != 0 {
+		t.Fatalf("stats = %+v, want 3 migrated", stats)
+	}
+	if _, err := os.Stat(checkpointPath); !os.IsNotExist(err) {
+		t.Errorf("checkpoint not removed after completion: %v", err)
+	}
+
+	for i, hash := range hashes {
+		var image models.Image
+		if err := models.ImagesCollection.FindOne(ctx, bson.M{"hash": hash}).Decode(&image); err != nil {
+			t.Fatal(err)
+		}
+		_, srcErr := source.Get(ctx, hash)
+		_, destErr := dest.Get(ctx, hash)
+		if i < 2 {
+			if image.Backend() != storage.BackendMongo || srcErr != nil || destErr != storage.ErrNotFound {
+				t.Errorf("%s before checkpoint: backend %s, source %v, dest %v", hash, image.Backend(), srcErr, destErr)
+			}
+			continue
+		}
+		if image.Backend() != storage.BackendLocal || srcErr != storage.ErrNotFound || destErr != nil {
+			t.Errorf("%s after checkpoint: backend %s, source %v, dest %v", hash, image.Backend(), srcErr, destErr)
+		}
+	}
+
+	// 没有检查点时处理剩余的图片
+	stats = migrateImages(ctx, models.ImagesCollection, source, dest)
+	if stats.Migrated != 2 {
+		t.Errorf("second run migrated %d, want 2", stats.Migrated)
+	}
+}
+
+func TestMigrateImagesDryRun(t *testing.T) {
+	testutil.SetupDB(t)
+	ctx := context.Background()
+	setMigrateFlags(t, storage.BackendMongo, storage.BackendLocal)
+	dryRun = true
+	source := storage.NewMongoStore(models.ImagesCollection)
+	dest, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := insertMongoImages(t, 3)
+
+	stats := migrateImages(ctx, models.ImagesCollection, source, dest)
+	if stats.Migrated != 3 {
+		t.Fatalf("dry run reported %d, want 3", stats.Migrated)
+	}
+	if _, err := os.Stat(checkpointPath); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote a checkpoint: %v", err)
+	}
+	n, _ := models.ImagesCollection.CountDocuments(ctx, models.StorageFilter(storage.BackendMongo))
+	if n != 3 {
+		t.Errorf("%d records left in mongo after dry run, want 3", n)
+	}
+	for _, hash := range hashes {
+		if _, err := dest.Get(ctx, hash); err != storage.ErrNotFound {
+			t.Errorf("dry run wrote %s: %v", hash, err)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+)
+
+// 检查发现的问题类型
+const (
+	IssueMissingObject  = "missing_object"  // 记录存在但存储中没有数据
+	IssueHashMismatch   = "hash_mismatch"   // 数据的 MD5 与记录不一致
+	IssueOrphanObject   = "orphan_object"   // 存储中的对象没有对应的记录
+	IssueReadError      = "read_error"      // 读取数据失败，无法判断
+	IssueUnknownBackend = "unknown_backend" // 记录指向未配置的存储后端
+)
+
+// 修复操作
+const (
+	RepairRelinked = "relinked" // 记录改为指向另一个后端中完好的副本
+	RepairTrashed  = "trashed"  // 没有完好的副本，记录移入回收站
+	RepairDeleted  = "deleted"  // 删除孤立对象
+	RepairFailed   = "failed"
+)
+
+// orphanGrace 最近写入的对象可能属于正在进行的上传，不视为孤立对象
+const orphanGrace = time.Hour
+
+// Issue 单个问题，Repair 为空表示未修复
+type Issue struct {
+	Kind    string `json:"kind"`
+	Hash    string `json:"hash"`
+	Backend string `json:"backend"`
+	Detail  string `json:"detail,omitempty"`
+	Repair  string `json:"repair,omitempty"`
+}
+
+// Report verify 子命令写入的检查报告
+type Report struct {
+	StartedAt  time.Time        `json:"startedAt"`
+	FinishedAt time.Time        `json:"finishedAt"`
+	Repair     bool             `json:"repair"`
+	SkipHash   bool             `json:"skipHash"`
+	Records    int64            `json:"records"`
+	Objects    map[string]int64 `json:"objects"`
+	Summary    map[string]int   `json:"summary"`
+	Issues     []Issue          `json:"issues"`
+}
+
+// verifyRecord 校验记录时只需要的字段
+type verifyRecord struct {
+	Hash      string     `bson:"hash"`
+	UseS3     bool       `bson:"useS3"`
+	Storage   string     `bson:"storage"`
+	Checksum  string     `bson:"checksum"`
+	DeletedAt *time.Time `bson:"deletedAt"`
+}
+
+func (r verifyRecord) backend() string {
+	image := models.Image{Storage: r.Storage, UseS3: r.UseS3}
+	return image.Backend()
+}
+
+// expected 返回数据应有的 MD5，重新编码过的图片以 checksum 为准
+func (r verifyRecord) expected() string {
+	if r.Checksum != "" {
+		return r.Checksum
+	}
+	return r.Hash
+}
+
+type verifier struct {
+	collection *mongo.Collection
+	stores     map[string]storage.ImageStore
+	repair     bool
+	skipHash   bool
+	workers    int
+
+	mu     sync.Mutex
+	report Report
+	// known 每个后端中有记录指向的 hash，用于查找孤立对象
+	known map[string]map[string]bool
+}
+
+func newVerifier(collection *mongo.Collection, stores map[string]storage.ImageStore, repair, skipHash bool, workers int) *verifier {
+	return &verifier{
+		collection: collection,
+		stores:     stores,
+		repair:     repair,
+		skipHash:   skipHash,
+		workers:    workers,
+		report: Report{
+			StartedAt: time.Now(),
+			Repair:    repair,
+			SkipHash:  skipHash,
+			Objects:   make(map[string]int64),
+			Summary:   make(map[string]int),
+			Issues:    []Issue{},
+		},
+		known: make(map[string]map[string]bool),
+	}
+}
+
+func (v *verifier) addIssue(issue Issue) {
+	v.mu.Lock()
+	v.report.Issues = append(v.report.Issues, issue)
+	v.mu.Unlock()
+	if issue.Repair != "" {
+		log.Printf("%s: %s in %s (%s) -> %s", issue.Kind, issue.Hash, issue.Backend, issue.Detail, issue.Repair)
+	} else {
+		log.Printf("%s: %s in %s (%s)", issue.Kind, issue.Hash, issue.Backend, issue.Detail)
+	}
+}
+
+func (v *verifier) markKnown(backend, hash string) {
+	v.mu.Lock()
+	if v.known[backend] == nil {
+		v.known[backend] = make(map[string]bool)
+	}
+	v.known[backend][hash] = true
+	v.mu.Unlock()
+}
+
+// runVerify 执行 verify 子命令，返回进程退出码
+//
+// 检查所有图片记录的数据是否存在且 MD5 与记录一致，再列出 S3 和本地存储中没有记录的孤立对象。
+// 发现问题且未修复时返回 1，便于在定时任务中报警
+func runVerify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "修复发现的问题：记录改为指向完好的副本，没有副本时移入回收站，删除孤立对象")
+	skipHash := fs.Bool("skip-hash", false, "只检查对象是否存在，不读取内容校验 MD5")
+	reportPath := fs.String("report", "", "检查报告路径，默认 verify-report-<时间>.json")
+	workers := fs.Int("concurrency", 20, "并发检查数量")
+	dir := fs.String("local-dir", os.Getenv("LOCAL_STORAGE_DIR"), "本地存储目录，为空时不检查本地存储")
+	fs.Parse(args)
+
+	if *workers < 1 {
+		log.Fatalf("-concurrency must be positive")
+	}
+	if *reportPath == "" {
+		*reportPath = fmt.Sprintf("verify-report-%s.json", time.Now().Format("20060102-150405"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mongoClient, minioClient, collection := initClients(ctx)
+	defer mongoClient.Disconnect(context.Background())
+
+	stores := map[string]storage.ImageStore{
+		storage.BackendMongo: storage.NewMongoStore(collection),
+		storage.BackendS3:    storage.NewMinioStore(minioClient, os.Getenv("MINIO_BUCKET")),
+	}
+	if *dir != "" {
+		local, err := storage.NewLocalStore(*dir)
+		if err != nil {
+			log.Fatalf("Failed to initialize local storage: %v", err)
+		}
+		stores[storage.BackendLocal] = local
+	}
+
+	v := newVerifier(collection, stores, *repair, *skipHash, *workers)
+
+	// 先检查记录再查找孤立对象，修复时改为指向其他副本的记录会先登记，不会被当作孤立对象删除
+	if err := v.checkRecords(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("Failed to check records: %v", err)
+		return 1
+	}
+	for _, name := range []string{storage.BackendS3, storage.BackendLocal} {
+		if store, ok := stores[name]; ok && ctx.Err() == nil {
+			if err := v.checkObjects(ctx, store); err != nil {
+				log.Printf("Failed to list %s objects: %v", name, err)
+				return 1
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		log.Println("Interrupted, report is incomplete")
+	}
+
+	v.report.FinishedAt = time.Now()
+	unresolved := 0
+	sort.Slice(v.report.Issues, func(i, j int) bool {
+		a, b := v.report.Issues[i], v.report.Issues[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Hash < b.Hash
+	})
+	for _, issue := range v.report.Issues {
+		v.report.Summary[issue.Kind]++
+		if issue.Repair == "" || issue.Repair == RepairFailed {
+			unresolved++
+		}
+	}
+
+	raw, err := json.MarshalIndent(v.report, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode report: %v", err)
+		return 1
+	}
+	if err := os.WriteFile(*reportPath, raw, 0644); err != nil {
+		log.Printf("Failed to write report: %v", err)
+		return 1
+	}
+
+	fmt.Printf("\nVerification completed in %s\n", v.report.FinishedAt.Sub(v.report.StartedAt).Round(time.Second))
+	fmt.Printf("Records checked: %d\n", v.report.Records)
+	for name, count := range v.report.Objects {
+		fmt.Printf("Objects in %s: %d\n", name, count)
+	}
+	for kind, count := range v.report.Summary {
+		fmt.Printf("%s: %d\n", kind, count)
+	}
+	fmt.Printf("Unresolved issues: %d\n", unresolved)
+	fmt.Printf("Report written to %s\n", *reportPath)
+
+	if unresolved > 0 || ctx.Err() != nil {
+		return 1
+	}
+	return 0
+}
+
+// checkRecords 并发检查所有图片记录（包括回收站中的）
+func (v *verifier) checkRecords(ctx context.Context) error {
+	opts := options.Find().SetProjection(bson.M{
+		"hash": 1, "useS3": 1, "storage": 1, "checksum": 1, "deletedAt": 1,
+	})
+	cursor, err := v.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	records := make(chan verifyRecord, v.workers)
+	var wg sync.WaitGroup
+	for i := 0; i < v.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for record := range records {
+				v.checkRecord(ctx, record)
+			}
+		}()
+	}
+
+	for cursor.Next(ctx) {
+		var record verifyRecord
+		if err := cursor.Decode(&record); err != nil {
+			log.Printf("Failed to decode image record: %v", err)
+			continue
+		}
+		v.mu.Lock()
+		v.report.Records++
+		if v.report.Records%1000 == 0 {
+			log.Printf("Checked %d records", v.report.Records)
+		}
+		v.mu.Unlock()
+		records <- record
+	}
+	close(records)
+	wg.Wait()
+	return cursor.Err()
+}
+
+func (v *verifier) checkRecord(ctx context.Context, record verifyRecord) {
+	backend := record.backend()
+	v.markKnown(backend, record.Hash)
+
+	store, ok := v.stores[backend]
+	if !ok {
+		v.addIssue(Issue{Kind: IssueUnknownBackend, Hash: record.Hash, Backend: backend, Detail: "backend is not configured"})
+		return
+	}
+
+	issue := Issue{Hash: record.Hash, Backend: backend}
+	if v.skipHash {
+		_, err := store.Stat(ctx, record.Hash)
+		switch {
+		case err == storage.ErrNotFound:
+			issue.Kind, issue.Detail = IssueMissingObject, "object not found"
+		case err != nil:
+			issue.Kind, issue.Detail = IssueReadError, err.Error()
+		default:
+			return
+		}
+	} else {
+		data, err := store.Get(ctx, record.Hash)
+		switch {
+		case err == storage.ErrNotFound:
+			issue.Kind, issue.Detail = IssueMissingObject, "object not found"
+		case err != nil:
+			issue.Kind, issue.Detail = IssueReadError, err.Error()
+		default:
+			sum := fmt.Sprintf("%x", md5.Sum(data))
+			if sum == record.expected() {
+				return
+			}
+			issue.Kind = IssueHashMismatch
+			issue.Detail = fmt.Sprintf("expected %s, got %s", record.expected(), sum)
+		}
+	}
+
+	// 读取失败可能是暂时的，不做修复
+	if v.repair && issue.Kind != IssueReadError && ctx.Err() == nil {
+		issue.Repair = v.repairRecord(ctx, record, backend)
+	}
+	v.addIssue(issue)
+}
+
+// repairRecord 在其他后端中查找 MD5 正确的副本并让记录指向它，找不到时将记录移入回收站
+//
+// 原后端中损坏的对象之后会作为孤立对象删除
+func (v *verifier) repairRecord(ctx context.Context, record verifyRecord, backend string) string {
+	for name, store := range v.stores {
+		if name == backend {
+			continue
+		}
+		data, err := store.Get(ctx, record.Hash)
+		if err != nil || fmt.Sprintf("%x", md5.Sum(data)) != record.expected() {
+			continue
+		}
+		_, err = v.collection.UpdateOne(ctx, bson.M{"hash": record.Hash}, bson.M{
+			"$set": bson.M{"storage": name, "useS3": name == storage.BackendS3},
+		})
+		if err != nil {
+			log.Printf("Failed to relink %s to %s: %v", record.Hash, name, err)
+			return RepairFailed
+		}
+		v.markKnown(name, record.Hash)
+		v.mu.Lock()
+		delete(v.known[backend], record.Hash)
+		v.mu.Unlock()
+		return RepairRelinked
+	}
+
+	if record.DeletedAt != nil {
+		return RepairTrashed
+	}
+	_, err := v.collection.UpdateOne(ctx, bson.M{"hash": record.Hash},
+		bson.M{"$set": bson.M{"deletedAt": time.Now()}})
+	if err != nil {
+		log.Printf("Failed to move %s to trash: %v", record.Hash, err)
+		return RepairFailed
+	}
+	return RepairTrashed
+}
+
+// checkObjects 列出后端中的所有对象，找出没有记录指向的孤立对象
+func (v *verifier) checkObjects(ctx context.Context, store storage.ImageStore) error {
+	name := store.Name()
+	log.Printf("Listing objects in %s storage...", name)
+	return store.List(ctx, func(info storage.ObjectInfo) error {
+		v.mu.Lock()
+		v.report.Objects[name]++
+		known := v.known[name][info.Hash]
+		v.mu.Unlock()
+		if known || time.Since(info.LastModified) < orphanGrace {
+			return nil
+		}
+
+		issue := Issue{
+			Kind:    IssueOrphanObject,
+			Hash:    info.Hash,
+			Backend: name,
+			Detail:  fmt.Sprintf("size %d, modified %s", info.Size, info.LastModified.Format(time.RFC3339)),
+		}
+		if v.repair {
+			issue.Repair = RepairDeleted
+			if err := store.Delete(ctx, info.Hash); err != nil {
+				log.Printf("Failed to delete orphan %s from %s: %v", info.Hash, name, err)
+				issue.Repair = RepairFailed
+			}
+		}
+		v.addIssue(issue)
+		return nil
+	})
+}
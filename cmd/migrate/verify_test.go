@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+)
+
+func md5Hex(data []byte) string {
+	return fmt.Sprintf("%x", md5.Sum(data))
+}
+
+// runChecks 检查所有记录和本地存储中的对象，返回按 hash 索引的问题
+func runChecks(t *testing.T, v *verifier, local storage.ImageStore) map[string]Issue {
+	t.Helper()
+	ctx := context.Background()
+	if err := v.checkRecords(ctx); err != nil {
+		t.Fatalf("checkRecords: %v", err)
+	}
+	if err := v.checkObjects(ctx, local); err != nil {
+		t.Fatalf("checkObjects: %v", err)
+	}
+	issues := make(map[string]Issue)
+	for _, issue := range v.report.Issues {
+		issues[issue.Hash] = issue
+	}
+	return issues
+}
+
+func TestVerifyReportsAndRepairsIssues(t *testing.T) {
+	testutil.SetupDB(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	local, err := storage.NewLocalStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mongoStore := storage.NewMongoStore(models.ImagesCollection)
+	stores := map[string]storage.ImageStore{storage.BackendMongo: mongoStore, storage.BackendLocal: local}
+
+	insert := func(data []byte, backend string) string {
+		hash := md5Hex(data)
+		image := models.Image{Hash: hash, Storage: backend, CreatedAt: time.Now()}
+		if _, err := models.ImagesCollection.InsertOne(ctx, image); err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	put := func(store storage.ImageStore, hash string, data []byte) {
+		if err := store.Put(ctx, hash, data, "image/webp"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	good := insert([]byte("good"), storage.BackendLocal)
+	put(local, good, []byte("good"))
+	// 本地缺失，MongoDB 中有完好的副本
+	relinked := insert([]byte("relinked"), storage.BackendLocal)
+	put(mongoStore, relinked, []byte("relinked"))
+	// 本地数据损坏，没有其他副本
+	corrupt := insert([]byte("corrupt"), storage.BackendLocal)
+	put(local, corrupt, []byte("damaged"))
+	unknown := insert([]byte("unknown"), storage.BackendS3)
+	orphan := md5Hex([]byte("orphan"))
+	put(local, orphan, []byte("orphan"))
+	old := time.Now().Add(-2 * orphanGrace)
+	if err := os.Chtimes(filepath.Join(dir, orphan+".webp"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	// 刚写入的对象可能属于正在进行的上传
+	recent := md5Hex([]byte("recent"))
+	put(local, recent, []byte("recent"))
+
+	want := map[string]string{
+		relinked: IssueMissingObject,
+		corrupt:  IssueHashMismatch,
+		unknown:  IssueUnknownBackend,
+		orphan:   IssueOrphanObject,
+	}
+	issues := runChecks(t, newVerifier(models.ImagesCollection, stores, false, false, 2), local)
+	if len(issues) != len(want) {
+		t.Errorf("issues = %+v, want %d", issues, len(want))
+	}
+	for hash, kind := range want {
+		if issue := issues[hash]; issue.Kind != kind || issue.Repair != "" {
+			t.Errorf("%s: issue %+v, want unrepaired %s", hash, issue, kind)
+		}
+	}
+
+	// -skip-hash 只检查对象是否存在
+	issues = runChecks(t, newVerifier(models.ImagesCollection, stores, false, true, 2), local)
+	if _, ok := issues[corrupt]; ok {
+		t.Errorf("hash mismatch reported with -skip-hash")
+	}
+
+	issues = runChecks(t, newVerifier(models.ImagesCollection, stores, true, false, 2), local)
+	for hash, repair := range map[string]string{relinked: RepairRelinked, corrupt: RepairTrashed, orphan: RepairDeleted, unknown: ""} {
+		if issues[hash].Repair != repair {
+			t.Errorf("%s: repair %q, want %q", hash, issues[hash].Repair, repair)
+		}
+	}
+
+	var image models.Image
+	if err := models.ImagesCollection.FindOne(ctx, bson.M{"hash": relinked}).Decode(&image); err != nil || image.Backend() != storage.BackendMongo {
+		t.Errorf("relinked record: backend %s, %v", image.Backend(), err)
+	}
+	image = models.Image{}
+	if err := models.ImagesCollection.FindOne(ctx, bson.M{"hash": corrupt}).Decode(&image); err != nil || image.DeletedAt == nil {
+		t.Errorf("corrupt record not moved to trash: %+v, %v", image, err)
+	}
+	if _, err := local.Get(ctx, orphan); err != storage.ErrNotFound {
+		t.Errorf("orphan object not deleted: %v", err)
+	}
+	if _, err := local.Get(ctx, recent); err != nil {
+		t.Errorf("recent object deleted: %v", err)
+	}
+}
@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/models"
+)
+
+var albumSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+type albumResponse struct {
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	Cover       string    `json:"cover,omitempty"`
+	CoverURL    string    `json:"coverUrl,omitempty"`
+	ImageCount  int       `json:"imageCount"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// newAlbumResponse 未设置封面时使用相册中的第一张图片
+func newAlbumResponse(album models.Album) albumResponse {
+	cover := album.Cover
+	if cover == "" && len(album.Images) > 0 {
+		cover = album.Images[0]
+	}
+	resp := albumResponse{
+		Slug:        album.Slug,
+		Title:       album.Title,
+		Description: album.Description,
+		Cover:       cover,
+		ImageCount:  len(album.Images),
+		CreatedAt:   album.CreatedAt,
+		UpdatedAt:   album.UpdatedAt,
+	}
+	if cover != "" {
+		resp.CoverURL = imageURL(cover)
+	}
+	return resp
+}
+
+func findAlbum(ctx context.Context, slug string) (models.Album, error) {
+	var album models.Album
+	err := models.AlbumsCollection.FindOne(ctx, bson.M{"slug": slug}).Decode(&album)
+	return album, err
+}
+
+// respondAlbumError 统一处理相册查询错误
+func respondAlbumError(c *gin.Context, err error) {
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// uniqueHashes 去除空值和重复的 hash，保持原有顺序
+func uniqueHashes(hashes []string) []string {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, hash := range hashes {
+		hash = strings.TrimSpace(hash)
+		if hash == "" || seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		result = append(result, hash)
+	}
+	return result
+}
+
+// missingImages 返回数据库中不存在的图片 hash
+func missingImages(ctx context.Context, hashes []string) ([]string, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+	cursor, err := models.ImagesCollection.Find(ctx, notDeleted(bson.M{"hash": bson.M{"$in": hashes}}),
+		options.Find().SetProjection(bson.M{"hash": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var images []models.Image
+	if err := cursor.All(ctx, &images); err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(images))
+	for _, image := range images {
+		found[image.Hash] = true
+	}
+	var missing []string
+	for _, hash := range hashes {
+		if !found[hash] {
+			missing = append(missing, hash)
+		}
+	}
+	return missing, nil
+}
+
+// checkImagesExist 图片不存在时返回 400 并返回 false
+func checkImagesExist(c *gin.Context, hashes []string) bool {
+	missing, err := missingImages(c.Request.Context(), hashes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Images not found", "hashes": missing})
+		return false
+	}
+	return true
+}
+
+// removeImageFromAlbums 图片永久删除后从所有相册中移除
+func removeImageFromAlbums(ctx context.Context, hash string) error {
+	now := time.Now()
+	if _, err := models.AlbumsCollection.UpdateMany(ctx, bson.M{"images": hash}, bson.M{
+		"$pull": bson.M{"images": hash},
+		"$set":  bson.M{"updatedAt": now},
+	}); err != nil {
+		return err
+	}
+	_, err := models.AlbumsCollection.UpdateMany(ctx, bson.M{"cover": hash}, bson.M{
+		"$unset": bson.M{"cover": ""},
+		"$set":   bson.M{"updatedAt": now},
+	})
+	return err
+}
+
+// albumFilter 将随机图片限定在相册范围内
+func albumFilter(ctx context.Context, slug string) (bson.M, error) {
+	album, err := findAlbum(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"$in": album.Images}, nil
+}
+
+// ListAlbums 列出所有相册（不含图片列表）
+func ListAlbums(c *gin.Context) {
+	ctx := c.Request.Context()
+	cursor, err := models.AlbumsCollection.Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var albums []models.Album
+	if err := cursor.All(ctx, &albums); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]albumResponse, len(albums))
+	for i, album := range albums {
+		results[i] = newAlbumResponse(album)
+	}
+	c.JSON(http.StatusOK, gin.H{"albums": results})
+}
+
+// GetAlbum 按相册顺序返回图片
+func GetAlbum(c *gin.Context) {
+	ctx := c.Request.Context()
+	album, err := findAlbum(ctx, c.Param("slug"))
+	if err != nil {
+		respondAlbumError(c, err)
+		return
+	}
+
+	images := []gin.H{}
+	if len(album.Images) > 0 {
+		cursor, err := models.ImagesCollection.Find(ctx, notDeleted(bson.M{"hash": bson.M{"$in": album.Images}}),
+			options.Find().SetProjection(bson.M{"data": 0}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var found []models.Image
+		if err := cursor.All(ctx, &found); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		byHash := make(map[string]models.Image, len(found))
+		for _, image := range found {
+			byHash[image.Hash] = image
+		}
+		for _, hash := range album.Images {
+			if image, ok := byHash[hash]; ok {
+				images = append(images, gin.H{
+					"url":   imageURL(hash),
+					"image": newLowerImage(image),
+				})
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"album":  newAlbumResponse(album),
+		"images": images,
+	})
+}
+
+type createAlbumRequest struct {
+	Slug        string   `json:"slug"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Cover       string   `json:"cover"`
+	Images      []string `json:"images"`
+}
+
+func CreateAlbum(c *gin.Context) {
+	var req createAlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Slug = strings.ToLower(strings.TrimSpace(req.Slug))
+	if !albumSlugPattern.MatchString(req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid slug: use lowercase letters, digits and '-'"})
+		return
+	}
+
+	images := uniqueHashes(req.Images)
+	if !checkImagesExist(c, images) {
+		return
+	}
+	if req.Cover != "" && !containsString(images, req.Cover) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cover must be one of the album images"})
+		return
+	}
+
+	now := time.Now()
+	album := models.Album{
+		Slug:        req.Slug,
+		Title:       strings.TrimSpace(req.Title),
+		Description: strings.TrimSpace(req.Description),
+		Cover:       req.Cover,
+		Images:      images,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := models.AlbumsCollection.InsertOne(c.Request.Context(), album); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Album already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newAlbumResponse(album))
+}
+
+type updateAlbumRequest struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Cover       *string `json:"cover"`
+}
+
+func UpdateAlbum(c *gin.Context) {
+	var req updateAlbumRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	album, err := findAlbum(ctx, c.Param("slug"))
+	if err != nil {
+		respondAlbumError(c, err)
+		return
+	}
+
+	set := bson.M{"updatedAt": time.Now()}
+	update := bson.M{"$set": set}
+	if req.Title != nil {
+		set["title"] = strings.TrimSpace(*req.Title)
+	}
+	if req.Description != nil {
+		set["description"] = strings.TrimSpace(*req.Description)
+	}
+	if req.Cover != nil {
+		// 空字符串表示恢复为默认封面（第一张图片）
+		if *req.Cover == "" {
+			update["$unset"] = bson.M{"cover": ""}
+		} else if !containsString(album.Images, *req.Cover) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cover must be one of the album images"})
+			return
+		} else {
+			set["cover"] = *req.Cover
+		}
+	}
+
+	var updated models.Album
+	err = models.AlbumsCollection.FindOneAndUpdate(ctx, bson.M{"slug": album.Slug}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err != nil {
+		respondAlbumError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newAlbumResponse(updated))
+}
+
+func DeleteAlbum(c *gin.Context) {
+	result, err := models.AlbumsCollection.DeleteOne(c.Request.Context(), bson.M{"slug": c.Param("slug")})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Album deleted successfully"})
+}
+
+type albumImagesRequest struct {
+	Hashes []string `json:"hashes"`
+	// Position 插入位置，未指定时追加到末尾
+	Position *int `json:"position"`
+}
+
+// updateAlbumImages 对相册执行条件更新并返回更新后的图片列表
+//
+// filter 除 slug 外的条件不满足时返回 409，调用方应在读取相册后再构造条件
+func updateAlbumImages(c *gin.Context, filter bson.M, update bson.M) {
+	ctx := c.Request.Context()
+	var updated models.Album
+	err := models.AlbumsCollection.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusConflict, gin.H{"error": "Album was modified by another request, please retry"})
+		return
+	}
+	if err != nil {
+		respondAlbumError(c, err)
+		return
+	}
+
+	// 封面不在列表中时清除，只在封面仍是原值时修改
+	if updated.Cover != "" && !containsString(updated.Images, updated.Cover) {
+		// 解码到新的变量，已清除的 cover 字段不会覆盖旧值
+		var cleared models.Album
+		err = models.AlbumsCollection.FindOneAndUpdate(ctx,
+			bson.M{"slug": updated.Slug, "cover": updated.Cover, "images": bson.M{"$ne": updated.Cover}},
+			bson.M{"$unset": bson.M{"cover": ""}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&cleared)
+		switch {
+		case err == nil:
+			updated = cleared
+		case err != mongo.ErrNoDocuments:
+			respondAlbumError(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"album":  newAlbumResponse(updated),
+		"images": updated.Images,
+	})
+}
+
+// AddAlbumImages 向相册添加图片，已在相册中的图片会被忽略
+//
+// 使用 $push 插入，只有要添加的图片仍都不在相册中时才会更新，不会覆盖其他请求的修改
+func AddAlbumImages(c *gin.Context) {
+	var req albumImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hashes := uniqueHashes(req.Hashes)
+	if len(hashes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "hashes is required"})
+		return
+	}
+
+	album, err := findAlbum(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		respondAlbumError(c, err)
+		return
+	}
+	if !checkImagesExist(c, hashes) {
+		return
+	}
+
+	added := []string{}
+	for _, hash := range hashes {
+		if !containsString(album.Images, hash) {
+			added = append(added, hash)
+		}
+	}
+
+	push := bson.M{"$each": added}
+	if req.Position != nil {
+		if *req.Position < 0 || *req.Position > len(album.Images) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid position: must be between 0 and %d", len(album.Images))})
+			return
+		}
+		push["$position"] = *req.Position
+	}
+
+	updateAlbumImages(c,
+		bson.M{"slug": album.Slug, "images": bson.M{"$nin": added}},
+		bson.M{"$push": bson.M{"images": push}, "$set": bson.M{"updatedAt": time.Now()}},
+	)
+}
+
+// ReorderAlbumImages 用新的列表替换相册中的图片及顺序
+//
+// 只有相册在读取后没有被修改（updatedAt 不变）时才会替换
+func ReorderAlbumImages(c *gin.Context) {
+	var req albumImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	album, err := findAlbum(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		respondAlbumError(c, err)
+		return
+	}
+	hashes := uniqueHashes(req.Hashes)
+	if !checkImagesExist(c, hashes) {
+		return
+	}
+	updateAlbumImages(c,
+		bson.M{"slug": album.Slug, "updatedAt": album.UpdatedAt},
+		bson.M{"$set": bson.M{"images": hashes, "updatedAt": time.Now()}},
+	)
+}
+
+func RemoveAlbumImage(c *gin.Context) {
+	album, err := findAlbum(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		respondAlbumError(c, err)
+		return
+	}
+
+	hash := c.Param("hash")
+	if !containsString(album.Images, hash) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not in album"})
+		return
+	}
+
+	updateAlbumImages(c,
+		bson.M{"slug": album.Slug, "images": hash},
+		bson.M{"$pull": bson.M{"images": hash}, "$set": bson.M{"updatedAt": time.Now()}},
+	)
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/models"
+)
+
+// insertImages 直接插入只有 hash 和创建时间的图片记录，按参数顺序依次变新
+func insertImages(t *testing.T, hashes ...string) {
+	t.Helper()
+	now := time.Now()
+	for i, hash := range hashes {
+		image := models.Image{Hash: hash, CreatedAt: now.Add(time.Duration(i) * time.Second), Storage: "memory"}
+		if _, err := models.ImagesCollection.InsertOne(context.Background(), image); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// requestJSON 发送 JSON 请求并把响应解析到 out（不为 nil 时）
+func requestJSON(t *testing.T, r *gin.Engine, method, target string, body, out interface{}) int {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: invalid response %s", method, target, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+func newAlbumRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/albums", ListAlbums)
+	r.GET("/albums/:slug", GetAlbum)
+	r.POST("/admin/albums", CreateAlbum)
+	r.PATCH("/admin/albums/:slug", UpdateAlbum)
+	r.DELETE("/admin/albums/:slug", DeleteAlbum)
+	r.POST("/admin/albums/:slug/images", AddAlbumImages)
+	r.PUT("/admin/albums/:slug/images", ReorderAlbumImages)
+	r.DELETE("/admin/albums/:slug/images/:hash", RemoveAlbumImage)
+	return r
+}
+
+type albumImagesResponse struct {
+	Album  albumResponse `json:"album"`
+	Images []string      `json:"images"`
+}
+
+func TestAlbumLifecycle(t *testing.T) {
+	testutil.SetupDB(t)
+	insertImages(t, "a", "b", "c")
+	r := newAlbumRouter()
+
+	var album albumResponse
+	code := requestJSON(t, r, http.MethodPost, "/admin/albums",
+		gin.H{"slug": "Trip", "title": " 旅行 ", "images": []string{"a", "b", "a"}, "cover": "b"}, &album)
+	if code != http.StatusCreated || album.Slug != "trip" || album.Title != "旅行" || album.ImageCount != 2 || album.Cover != "b" {
+		t.Fatalf("create: %d %+v", code, album)
+	}
+
+	for name, body := range map[string]gin.H{
+		"duplicate slug": {"slug": "trip"},
+		"invalid slug":   {"slug": "Trip 2024!"},
+		"missing image":  {"slug": "other", "images": []string{"missing"}},
+		"cover outside":  {"slug": "other", "images": []string{"a"}, "cover": "c"},
+	} {
+		want := http.StatusBadRequest
+		if name == "duplicate slug" {
+			want = http.StatusConflict
+		}
+		if code := requestJSON(t, r, http.MethodPost, "/admin/albums", body, nil); code != want {
+			t.Errorf("create with %s: status %d, want %d", name, code, want)
+		}
+	}
+
+	// 插入到开头，已在相册中的图片被忽略
+	var images albumImagesResponse
+	code = requestJSON(t, r, http.MethodPost, "/admin/albums/trip/images",
+		gin.H{"hashes": []string{"c", "a"}, "position": 0}, &images)
+	if code != http.StatusOK || fmt.Sprint(images.Images) != "[c a b]" {
+		t.Fatalf("add images: %d %v", code, images.Images)
+	}
+	if code := requestJSON(t, r, http.MethodPost, "/admin/albums/trip/images",
+		gin.H{"hashes": []string{"a"}, "position": 9}, nil); code != http.StatusBadRequest {
+		t.Errorf("add at invalid position: status %d, want 400", code)
+	}
+
+	code = requestJSON(t, r, http.MethodPut, "/admin/albums/trip/images", gin.H{"hashes": []string{"b", "a", "c"}}, &images)
+	if code != http.StatusOK || fmt.Sprint(images.Images) != "[b a c]" {
+		t.Fatalf("reorder: %d %v", code, images.Images)
+	}
+
+	// 移除封面图片后恢复为默认封面（第一张图片）
+	code = requestJSON(t, r, http.MethodDelete, "/admin/albums/trip/images/b", nil, &images)
+	if code != http.StatusOK || fmt.Sprint(images.Images) != "[a c]" || images.Album.Cover != "a" {
+		t.Fatalf("remove cover image: %d %+v", code, images)
+	}
+	if code := requestJSON(t, r, http.MethodDelete, "/admin/albums/trip/images/b", nil, nil); code != http.StatusNotFound {
+		t.Errorf("remove image not in album: status %d, want 404", code)
+	}
+
+	code = requestJSON(t, r, http.MethodPatch, "/admin/albums/trip", gin.H{"title": "新标题", "cover": "c"}, &album)
+	if code != http.StatusOK || album.Title != "新标题" || album.Cover != "c" {
+		t.Fatalf("update: %d %+v", code, album)
+	}
+	if code := requestJSON(t, r, http.MethodPatch, "/admin/albums/trip", gin.H{"cover": "b"}, nil); code != http.StatusBadRequest {
+		t.Errorf("update cover outside album: status %d, want 400", code)
+	}
+
+	// 回收站中的图片不出现在相册中
+	_, err := models.ImagesCollection.UpdateOne(context.Background(), bson.M{"hash": "a"},
+		bson.M{"$set": bson.M{"deletedAt": time.Now()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var detail struct {
+		Images []struct {
+			Image struct {
+				Hash string `json:"hash"`
+			} `json:"image"`
+		} `json:"images"`
+	}
+	if code := requestJSON(t, r, http.MethodGet, "/albums/trip", nil, &detail); code != http.StatusOK {
+		t.Fatalf("get album: status %d", code)
+	}
+	if len(detail.Images) != 1 || detail.Images[0].Image.Hash != "c" {
+		t.Errorf("album images = %+v, want only c", detail.Images)
+	}
+
+	var list struct {
+		Albums []albumResponse `json:"albums"`
+	}
+	if code := requestJSON(t, r, http.MethodGet, "/albums", nil, &list); code != http.StatusOK || len(list.Albums) != 1 {
+		t.Errorf("list albums: %d %+v", code, list)
+	}
+
+	if code := requestJSON(t, r, http.MethodDelete, "/admin/albums/trip", nil, nil); code != http.StatusOK {
+		t.Errorf("delete album: status %d", code)
+	}
+	if code := requestJSON(t, r, http.MethodGet, "/albums/trip", nil, nil); code != http.StatusNotFound {
+		t.Errorf("get deleted album: status %d, want 404", code)
+	}
+}
+
+func TestAlbumConcurrentModification(t *testing.T) {
+	testutil.SetupDB(t)
+	insertImages(t, "a", "b")
+	r := newAlbumRouter()
+	if code := requestJSON(t, r, http.MethodPost, "/admin/albums", gin.H{"slug": "race", "images": []string{"a"}}, nil); code != http.StatusCreated {
+		t.Fatalf("create: status %d", code)
+	}
+
+	album, err := findAlbum(context.Background(), "race")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 读取相册后被其他请求修改，条件更新不生效
+	_, err = models.AlbumsCollection.UpdateOne(context.Background(), bson.M{"slug": "race"},
+		bson.M{"$set": bson.M{"updatedAt": album.UpdatedAt.Add(time.Second)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPut, "/", nil)
+	updateAlbumImages(c,
+		bson.M{"slug": album.Slug, "updatedAt": album.UpdatedAt},
+		bson.M{"$set": bson.M{"images": []string{"b"}}},
+	)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("stale update: status %d, want 409", rec.Code)
+	}
+}
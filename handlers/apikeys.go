@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"pysio.online/blog_api/auth"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/utils"
+)
+
+const maxAPIKeyNameLength = 100
+
+type lowerAPIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+func newLowerAPIKey(key models.APIKey) lowerAPIKey {
+	return lowerAPIKey{
+		ID:         key.ID,
+		Name:       key.Name,
+		Scopes:     key.Scopes,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+	}
+}
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresIn 有效期，如 "90d"、"720h"，为空时永不过期
+	ExpiresIn string `json:"expires_in"`
+}
+
+// CreateAPIKey 创建访问密钥，令牌只在响应中出现一次
+func CreateAPIKey(c *gin.Context) {
+	var req createAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxAPIKeyNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name is required and must be at most %d characters", maxAPIKeyNameLength)})
+		return
+	}
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("scopes is required, available: %s", strings.Join(auth.Scopes, ", "))})
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid scope: %s, available: %s", scope, strings.Join(auth.Scopes, ", "))})
+			return
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		d, err := utils.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid expires_in: %s", req.ExpiresIn)})
+			return
+		}
+		t := time.Now().Add(d)
+		expiresAt = &t
+	}
+
+	key, token, err := auth.Create(c.Request.Context(), req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"key":   newLowerAPIKey(key),
+		"token": token,
+	})
+}
+
+// ListAPIKeys 列出访问密钥，include_revoked=true 时包含已撤销的密钥
+func ListAPIKeys(c *gin.Context) {
+	keys, err := auth.List(c.Request.Context(), c.Query("include_revoked") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	results := make([]lowerAPIKey, len(keys))
+	for i, key := range keys {
+		results[i] = newLowerAPIKey(key)
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": results})
+}
+
+// RevokeAPIKey 撤销访问密钥，立即生效
+func RevokeAPIKey(c *gin.Context) {
+	key, err := auth.Revoke(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == auth.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found or already revoked"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked", "key": newLowerAPIKey(key)})
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"pysio.online/blog_api/auth"
+	"pysio.online/blog_api/internal/testutil"
+)
+
+func TestAPIKeyEndpoints(t *testing.T) {
+	testutil.SetupDB(t)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/admin/keys", ListAPIKeys)
+	r.POST("/admin/keys", CreateAPIKey)
+	r.DELETE("/admin/keys/:id", RevokeAPIKey)
+
+	for _, body := range []gin.H{
+		{"scopes": []string{auth.ScopeHeartbeat}},
+		{"name": "no scopes"},
+		{"name": "bad scope", "scopes": []string{"root"}},
+		{"name": "bad expiry", "scopes": []string{auth.ScopeHeartbeat}, "expires_in": "-1d"},
+	} {
+		if code := requestJSON(t, r, http.MethodPost, "/admin/keys", body, nil); code != http.StatusBadRequest {
+			t.Errorf("create %v: status %d, want 400", body, code)
+		}
+	}
+
+	var created struct {
+		Key   lowerAPIKey `json:"key"`
+		Token string      `json:"token"`
+	}
+	body := gin.H{"name": "laptop", "scopes": []string{auth.ScopeHeartbeat}, "expires_in": "30d"}
+	if code := requestJSON(t, r, http.MethodPost, "/admin/keys", body, &created); code != http.StatusCreated {
+		t.Fatalf("create: status %d", code)
+	}
+	if created.Token == "" || created.Key.ExpiresAt == nil {
+		t.Fatalf("created key: %+v", created)
+	}
+	principal, err := auth.Authenticate(context.Background(), created.Token)
+	if err != nil || !principal.HasScope(auth.ScopeHeartbeat) {
+		t.Fatalf("token from create: %+v, %v", principal, err)
+	}
+
+	var list struct {
+		Keys []lowerAPIKey `json:"keys"`
+	}
+	if code := requestJSON(t, r, http.MethodGet, "/admin/keys", nil, &list); code != http.StatusOK || len(list.Keys) != 1 {
+		t.Fatalf("list: status %d, %+v", code, list)
+	}
+
+	if code := requestJSON(t, r, http.MethodDelete, "/admin/keys/"+created.Key.ID, nil, nil); code != http.StatusOK {
+		t.Fatalf("revoke: status %d", code)
+	}
+	if code := requestJSON(t, r, http.MethodDelete, "/admin/keys/"+created.Key.ID, nil, nil); code != http.StatusNotFound {
+		t.Errorf("revoke twice: status %d, want 404", code)
+	}
+	if _, err := auth.Authenticate(context.Background(), created.Token); err != auth.ErrInvalidToken {
+		t.Errorf("revoked token: %v", err)
+	}
+	requestJSON(t, r, http.MethodGet, "/admin/keys", nil, &list)
+	if len(list.Keys) != 0 {
+		t.Errorf("revoked key listed: %+v", list.Keys)
+	}
+	requestJSON(t, r, http.MethodGet, "/admin/keys?include_revoked=true", nil, &list)
+	if len(list.Keys) != 1 || list.Keys[0].RevokedAt == nil {
+		t.Errorf("include_revoked: %+v", list.Keys)
+	}
+}
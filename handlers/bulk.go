@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/jobs"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+	"pysio.online/blog_api/utils"
+)
+
+// 批量操作类型
+const (
+	bulkDelete   = "delete"
+	bulkTag      = "tag"
+	bulkUntag    = "untag"
+	bulkMove     = "move"
+	bulkReencode = "reencode"
+)
+
+// maxBulkItems 单次批量操作最多处理的图片数
+const maxBulkItems = 5000
+
+// bulkFilter 按条件选择图片，各条件同时生效
+type bulkFilter struct {
+	Tags    []string `json:"tags"`
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Storage string   `json:"storage"`
+	// MaxSize 只选择小于该大小的图片，支持 K/M/G 后缀
+	MaxSize string `json:"max_size"`
+}
+
+type bulkRequest struct {
+	Action string      `json:"action"`
+	Hashes []string    `json:"hashes"`
+	Filter *bulkFilter `json:"filter"`
+	// Tags tag/untag 使用的标签
+	Tags []string `json:"tags"`
+	// Backend move 的目标存储后端
+	Backend string `json:"backend"`
+	// Permanent delete 时跳过回收站直接永久删除
+	Permanent bool `json:"permanent"`
+	// Quality/Lossless reencode 使用的编码参数
+	Quality  int  `json:"quality"`
+	Lossless bool `json:"lossless"`
+	DryRun   bool `json:"dry_run"`
+}
+
+// bulkOperation 已校验的批量操作参数
+type bulkOperation struct {
+	Action    string
+	Tags      []string
+	Store     storage.ImageStore
+	Permanent bool
+	WebP      utils.WebPOptions
+}
+
+// toBSON 将过滤条件转换为查询，回收站中的图片不会被选中
+func (f *bulkFilter) toBSON() (bson.M, error) {
+	filter := notDeleted(bson.M{})
+	if tags := normalizeTags(f.Tags); len(tags) > 0 {
+		filter["tags"] = bson.M{"$all": tags}
+	}
+
+	createdAt := bson.M{}
+	if f.From != "" {
+		t, err := parseListTime(f.From, false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from: %s", f.From)
+		}
+		createdAt["$gte"] = t
+	}
+	if f.To != "" {
+		t, err := parseListTime(f.To, true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to: %s", f.To)
+		}
+		createdAt["$lt"] = t
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+
+	if f.MaxSize != "" {
+		size, err := utils.ParseByteSize(f.MaxSize)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid max_size: %s", f.MaxSize)
+		}
+		filter["size"] = bson.M{"$lt": size}
+	}
+
+	if f.Storage != "" {
+		switch f.Storage {
+		case "mongo", "s3", "local", "memory":
+		default:
+			return nil, fmt.Errorf("invalid storage: %s", f.Storage)
+		}
+		filter = bson.M{"$and": bson.A{filter, models.StorageFilter(f.Storage)}}
+	}
+	return filter, nil
+}
+
+// parseBulkOperation 校验操作类型和对应的参数
+func parseBulkOperation(req bulkRequest) (bulkOperation, error) {
+	op := bulkOperation{Action: req.Action, Permanent: req.Permanent}
+	switch req.Action {
+	case bulkDelete:
+	case bulkTag, bulkUntag:
+		if op.Tags = normalizeTags(req.Tags); len(op.Tags) == 0 {
+			return op, fmt.Errorf("tags is required for %s", req.Action)
+		}
+	case bulkMove:
+		store, err := storage.Get(req.Backend)
+		if err != nil {
+			return op, fmt.Errorf("invalid backend: %s", req.Backend)
+		}
+		op.Store = store
+	case bulkReencode:
+		op.WebP = utils.DefaultWebPOptions()
+		op.WebP.Lossless = req.Lossless
+		if req.Quality != 0 {
+			if req.Quality < 1 || req.Quality > 100 {
+				return op, fmt.Errorf("invalid quality: must be between 1 and 100")
+			}
+			op.WebP.Quality = req.Quality
+		}
+	default:
+		return op, fmt.Errorf("invalid action: %s", req.Action)
+	}
+	return op, nil
+}
+
+// selectBulkImages 按 hash 列表或过滤条件查询图片，返回图片和不存在的 hash
+func selectBulkImages(ctx context.Context, req bulkRequest) ([]models.Image, []string, error) {
+	var filter bson.M
+	hashes := uniqueHashes(req.Hashes)
+	switch {
+	case len(hashes) > 0 && req.Filter != nil:
+		return nil, nil, fmt.Errorf("hashes and filter cannot be used together")
+	case len(hashes) > 0:
+		if len(hashes) > maxBulkItems {
+			return nil, nil, fmt.Errorf("too many hashes: at most %d", maxBulkItems)
+		}
+		filter = notDeleted(bson.M{"hash": bson.M{"$in": hashes}})
+	case req.Filter != nil:
+		var err error
+		if filter, err = req.Filter.toBSON(); err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, fmt.Errorf("hashes or filter is required")
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"data": 0}).
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "hash", Value: 1}}).
+		SetLimit(maxBulkItems + 1)
+	cursor, err := models.ImagesCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	var images []models.Image
+	if err := cursor.All(ctx, &images); err != nil {
+		return nil, nil, err
+	}
+	if len(images) > maxBulkItems {
+		return nil, nil, fmt.Errorf("too many images matched: at most %d, narrow the filter", maxBulkItems)
+	}
+
+	if len(hashes) == 0 {
+		return images, nil, nil
+	}
+	// 按请求中的顺序处理
+	byHash := make(map[string]models.Image, len(images))
+	for _, image := range images {
+		byHash[image.Hash] = image
+	}
+	ordered := make([]models.Image, 0, len(images))
+	var missing []string
+	for _, hash := range hashes {
+		if image, ok := byHash[hash]; ok {
+			ordered = append(ordered, image)
+		} else {
+			missing = append(missing, hash)
+		}
+	}
+	return ordered, missing, nil
+}
+
+// applyBulkOperation 对单张图片执行操作，dryRun 时只判断是否需要处理
+func applyBulkOperation(ctx context.Context, op bulkOperation, image *models.Image, dryRun bool) models.JobResult {
+	result := models.JobResult{Key: image.Hash, Status: jobs.ItemOK}
+	skip := func(reason string) models.JobResult {
+		result.Status = jobs.ItemSkipped
+		result.Reason = reason
+		return result
+	}
+	fail := func(err error) models.JobResult {
+		result.Status = jobs.ItemFailed
+		result.Reason = err.Error()
+		return result
+	}
+
+	switch op.Action {
+	case bulkDelete:
+		if dryRun {
+			return result
+		}
+		if op.Permanent {
+			ok, err := purgeImage(ctx, bson.M{"hash": image.Hash})
+			if err != nil {
+				return fail(err)
+			}
+			if !ok {
+				return skip("Image already deleted")
+			}
+			return result
+		}
+		_, err := models.ImagesCollection.UpdateOne(ctx, notDeleted(bson.M{"hash": image.Hash}),
+			bson.M{"$set": bson.M{"deletedAt": time.Now()}})
+		if err != nil {
+			return fail(err)
+		}
+
+	case bulkTag, bulkUntag:
+		var changed []string
+		for _, tag := range op.Tags {
+			if containsString(image.Tags, tag) == (op.Action == bulkUntag) {
+				changed = append(changed, tag)
+			}
+		}
+		if len(changed) == 0 {
+			return skip("Tags unchanged")
+		}
+		if dryRun {
+			return result
+		}
+		update := bson.M{"$addToSet": bson.M{"tags": bson.M{"$each": changed}}}
+		if op.Action == bulkUntag {
+			update = bson.M{"$pull": bson.M{"tags": bson.M{"$in": changed}}}
+		}
+		if _, err := models.ImagesCollection.UpdateOne(ctx, bson.M{"hash": image.Hash}, update); err != nil {
+			return fail(err)
+		}
+
+	case bulkMove:
+		if image.Backend() == op.Store.Name() {
+			return skip("Already in " + op.Store.Name() + " storage")
+		}
+		if dryRun {
+			return result
+		}
+		if err := moveImage(ctx, image, op.Store); err != nil {
+			return fail(err)
+		}
+
+	case bulkReencode:
+		if image.Animated {
+			return skip("Animated images are not re-encoded")
+		}
+		// 原图没有保存，只能从已有损压缩的 WebP 重新编码，每张图片只处理一次，避免反复压缩损失画质
+		if image.Checksum != "" {
+			return skip("Image has already been re-encoded")
+		}
+		if dryRun {
+			return result
+		}
+		saved, err := reencodeImage(ctx, image, op.WebP)
+		if err != nil {
+			return fail(err)
+		}
+		if saved <= 0 {
+			return skip("Re-encoded image is not smaller")
+		}
+		result.Reason = fmt.Sprintf("Saved %d bytes", saved)
+	}
+	return result
+}
+
+// moveImage 将图片数据复制到目标后端，更新记录后再删除原后端中的数据
+func moveImage(ctx context.Context, image *models.Image, target storage.ImageStore) error {
+	source, err := storage.ForImage(image)
+	if err != nil {
+		return err
+	}
+	data, err := source.Get(ctx, image.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to read image from %s storage: %v", source.Name(), err)
+	}
+	if err := target.Put(ctx, image.Hash, data, image.ContentType); err != nil {
+		return fmt.Errorf("failed to save image to %s storage: %v", target.Name(), err)
+	}
+
+	_, err = models.ImagesCollection.UpdateOne(ctx, bson.M{"hash": image.Hash}, bson.M{
+		"$set": bson.M{"storage": target.Name(), "useS3": target.Name() == storage.BackendS3},
+	})
+	if err != nil {
+		return err
+	}
+	// 记录已指向新后端，原数据删除失败不影响访问
+	_ = source.Delete(ctx, image.Hash)
+	return nil
+}
+
+// reencodeImage 用新的编码参数重新编码图片，只有变小时才替换，返回节省的字节数
+//
+// 新数据仍保存在原来的 hash 下，只清除本地缓存；/i/:hash 以 immutable 方式缓存，
+// 已缓存旧数据的 CDN 和浏览器在缓存过期前不会获取新数据
+func reencodeImage(ctx context.Context, image *models.Image, opts utils.WebPOptions) (int, error) {
+	store, err := storage.ForImage(image)
+	if err != nil {
+		return 0, err
+	}
+	data, err := store.Get(ctx, image.Hash)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read image from %s storage: %v", store.Name(), err)
+	}
+	img, _, err := utils.DecodeImage(data)
+	if err != nil {
+		return 0, fmt.Errorf("decode failed: %v", err)
+	}
+	encoded, err := utils.NewWebPEncoder().EncodeImage(img, opts)
+	if err != nil {
+		return 0, err
+	}
+	if len(encoded) >= len(data) {
+		return 0, nil
+	}
+
+	if err := store.Put(ctx, image.Hash, encoded, "image/webp"); err != nil {
+		return 0, fmt.Errorf("failed to save image to %s storage: %v", store.Name(), err)
+	}
+	_, err = models.ImagesCollection.UpdateOne(ctx, bson.M{"hash": image.Hash}, bson.M{
+		"$set": bson.M{
+			"contentType": "image/webp",
+			"size":        int64(len(encoded)),
+			"checksum":    fmt.Sprintf("%x", md5.Sum(encoded)),
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	utils.DeleteImageFromCache(image.Hash)
+	return len(data) - len(encoded), nil
+}
+
+// BulkImages 对一组图片执行批量操作
+//
+// dry_run 时同步返回每张图片是否会被处理；否则创建后台任务，通过 /admin/jobs/:id 查询进度
+func BulkImages(c *gin.Context) {
+	var req bulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	op, err := parseBulkOperation(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	images, missing, err := selectBulkImages(ctx, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.DryRun {
+		results := make([]jobResult, 0, len(images)+len(missing))
+		counts := make(map[string]int)
+		for _, hash := range missing {
+			results = append(results, jobResult{Key: hash, Status: jobs.ItemFailed, Reason: "Image not found"})
+			counts[jobs.ItemFailed]++
+		}
+		for i := range images {
+			r := applyBulkOperation(ctx, op, &images[i], true)
+			results = append(results, jobResult{Key: r.Key, Status: r.Status, Reason: r.Reason})
+			counts[r.Status]++
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"action":    op.Action,
+			"dryRun":    true,
+			"total":     len(results),
+			"succeeded": counts[jobs.ItemOK],
+			"skipped":   counts[jobs.ItemSkipped],
+			"failed":    counts[jobs.ItemFailed],
+			"results":   results,
+		})
+		return
+	}
+
+	params := map[string]interface{}{"action": op.Action, "images": len(images) + len(missing)}
+	switch op.Action {
+	case bulkDelete:
+		params["permanent"] = op.Permanent
+	case bulkTag, bulkUntag:
+		params["tags"] = op.Tags
+	case bulkMove:
+		params["backend"] = op.Store.Name()
+	case bulkReencode:
+		params["quality"] = op.WebP.Quality
+		params["lossless"] = op.WebP.Lossless
+	}
+
+	job, err := jobs.Submit("bulk", params, func(ctx context.Context, p *jobs.Progress) error {
+		p.SetTotal(len(images) + len(missing))
+		for _, hash := range missing {
+			p.Record(models.JobResult{Key: hash, Status: jobs.ItemFailed, Reason: "Image not found"})
+		}
+		for i := range images {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			p.Record(applyBulkOperation(ctx, op, &images[i], false))
+		}
+		return nil
+	})
+	respondJobSubmitted(c, job, err)
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"pysio.online/blog_api/utils"
+)
+
+type cacheStatsResponse struct {
+	Enabled   bool    `json:"enabled"`
+	Entries   int     `json:"entries"`
+	Bytes     int64   `json:"bytes"`
+	MaxBytes  int64   `json:"maxBytes"`
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	HitRate   float64 `json:"hitRate"`
+	Evictions int64   `json:"evictions"`
+	Corrupted int64   `json:"corrupted"`
+}
+
+func newCacheStatsResponse(stats utils.CacheStats) cacheStatsResponse {
+	resp := cacheStatsResponse{
+		Enabled:   stats.Enabled,
+		Entries:   stats.Entries,
+		Bytes:     stats.Bytes,
+		MaxBytes:  stats.MaxBytes,
+		Hits:      stats.Hits,
+		Misses:    stats.Misses,
+		Evictions: stats.Evictions,
+		Corrupted: stats.Corrupted,
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		resp.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return resp
+}
+
+// GetCacheStats 返回各缓存层的容量和命中统计
+func GetCacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"memory": newCacheStatsResponse(utils.MemoryCacheStats()),
+		"disk":   newCacheStatsResponse(utils.DiskCacheStats()),
+	})
+}
+
+// FlushCache 清空指定的缓存层，tier 可选 memory、disk、all
+func FlushCache(c *gin.Context) {
+	flushed := gin.H{}
+	switch tier := c.Param("tier"); tier {
+	case "memory":
+		flushed["memory"] = utils.FlushMemoryCache()
+	case "disk":
+		flushed["disk"] = utils.FlushDiskCache()
+	case "all":
+		flushed["memory"] = utils.FlushMemoryCache()
+		flushed["disk"] = utils.FlushDiskCache()
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid tier: %s", tier)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Cache flushed", "flushed": flushed})
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/jobs"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/utils"
+)
+
+const (
+	defaultDuplicateThreshold = 10
+	// 进程内的感知哈希索引每隔 phashIndexTTL 从数据库重新加载
+	phashIndexTTL = 10 * time.Minute
+)
+
+// similarImage 相似图片及其与目标图片的汉明距离
+type similarImage struct {
+	Hash      string    `json:"hash"`
+	Distance  int       `json:"distance"`
+	Width     int       `json:"width,omitempty"`
+	Height    int       `json:"height,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// duplicateThreshold 汉明距离不超过该值视为相似图片，可通过 DUPLICATE_THRESHOLD 配置
+func duplicateThreshold() int {
+	if value := os.Getenv("DUPLICATE_THRESHOLD"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 && n <= 64 {
+			return n
+		}
+	}
+	return defaultDuplicateThreshold
+}
+
+// phashFilter 匹配记录了感知哈希的图片
+func phashFilter() bson.M {
+	return notDeleted(bson.M{"phash": bson.M{"$exists": true, "$ne": ""}})
+}
+
+// eachPHash 按上传时间从早到晚遍历记录了感知哈希的图片，只读取 projection 中的字段
+func eachPHash(ctx context.Context, projection bson.M, fn func(image models.Image, value uint64) error) error {
+	cursor, err := models.ImagesCollection.Find(ctx, phashFilter(), options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}}).
+		SetProjection(projection))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var image models.Image
+		if err := cursor.Decode(&image); err != nil {
+			return err
+		}
+		value, err := utils.ParsePHash(image.PHash)
+		if err != nil {
+			continue
+		}
+		if err := fn(image, value); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// phashIndex 进程内的感知哈希索引，上传时查找相似图片不需要读取整个图库
+//
+// 首次使用时从数据库加载，之后新上传的图片直接加入；移入回收站或删除的图片在读取详细信息时过滤，
+// 恢复的图片和其他进程上传的图片在下次重新加载（phashIndexTTL）后纳入
+var phashIndex struct {
+	mu       sync.Mutex
+	tree     *utils.BKTree
+	loadedAt time.Time
+}
+
+// searchPHashIndex 在索引中查找与 target 距离不超过 threshold 的图片，索引过期时先重新加载
+func searchPHashIndex(ctx context.Context, target uint64, threshold int) ([]utils.BKMatch, error) {
+	phashIndex.mu.Lock()
+	defer phashIndex.mu.Unlock()
+
+	if phashIndex.tree == nil || time.Since(phashIndex.loadedAt) > phashIndexTTL {
+		tree := &utils.BKTree{}
+		err := eachPHash(ctx, bson.M{"hash": 1, "phash": 1}, func(image models.Image, value uint64) error {
+			tree.Add(image.Hash, value)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		phashIndex.tree, phashIndex.loadedAt = tree, time.Now()
+	}
+	return phashIndex.tree.Search(target, threshold), nil
+}
+
+// addToPHashIndex 把新计算出感知哈希的图片加入已加载的索引，索引尚未加载时不需要处理
+func addToPHashIndex(hash, phash string) {
+	value, err := utils.ParsePHash(phash)
+	if err != nil {
+		return
+	}
+	phashIndex.mu.Lock()
+	defer phashIndex.mu.Unlock()
+	if phashIndex.tree != nil {
+		phashIndex.tree.Add(hash, value)
+	}
+}
+
+// findSimilarImages 查找与 phash 距离不超过 threshold 的图片，按距离从小到大排序
+//
+// 先在 phashIndex 中查找，命中后再读取详细信息，同时排除已经不在图库中的图片
+func findSimilarImages(ctx context.Context, phash, exclude string, threshold int) ([]similarImage, error) {
+	target, err := utils.ParsePHash(phash)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := searchPHashIndex(ctx, target, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	distances := make(map[string]int)
+	hashes := bson.A{}
+	for _, match := range matches {
+		if match.Key == exclude {
+			continue
+		}
+		distances[match.Key] = match.Distance
+		hashes = append(hashes, match.Key)
+	}
+	similar := []similarImage{}
+	if len(hashes) == 0 {
+		return similar, nil
+	}
+
+	cursor, err := models.ImagesCollection.Find(ctx, notDeleted(bson.M{"hash": bson.M{"$in": hashes}}),
+		options.Find().SetProjection(bson.M{"hash": 1, "width": 1, "height": 1, "size": 1, "createdAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var matched []models.Image
+	if err := cursor.All(ctx, &matched); err != nil {
+		return nil, err
+	}
+	for _, image := range matched {
+		similar = append(similar, newSimilarImage(image, distances[image.Hash]))
+	}
+	sort.SliceStable(similar, func(i, j int) bool { return similar[i].Distance < similar[j].Distance })
+	return similar, nil
+}
+
+func newSimilarImage(image models.Image, distance int) similarImage {
+	return similarImage{
+		Hash:      image.Hash,
+		Distance:  distance,
+		Width:     image.Width,
+		Height:    image.Height,
+		Size:      image.Size,
+		CreatedAt: image.CreatedAt,
+	}
+}
+
+// FindDuplicateImages 在后台任务中生成相似图片报告，用于清理图库
+//
+// threshold 指定最大汉明距离。按上传时间从早到晚比较所有记录了感知哈希的图片，
+// 与更早上传的图片相似的图片记录为一条结果，related 为这些更早的图片及其距离；
+// 没有感知哈希的旧图片不参与比较，需要先通过 BackfillImageInfo 补充
+func FindDuplicateImages(c *gin.Context) {
+	threshold := duplicateThreshold()
+	if value := c.Query("threshold"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 64 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid threshold: must be between 0 and 64"})
+			return
+		}
+		threshold = n
+	}
+
+	job, err := jobs.Submit("find_duplicates", map[string]interface{}{"threshold": threshold},
+		func(ctx context.Context, p *jobs.Progress) error {
+			return findDuplicateImages(ctx, p, threshold)
+		})
+	respondJobSubmitted(c, job, err)
+}
+
+// findDuplicateImages 依次把图片加入 BK 树，加入前查找树中（即更早上传的）相似图片
+func findDuplicateImages(ctx context.Context, p *jobs.Progress, threshold int) error {
+	total, err := models.ImagesCollection.CountDocuments(ctx, phashFilter())
+	if err != nil {
+		return fmt.Errorf("failed to count images: %v", err)
+	}
+	p.SetTotal(int(total))
+
+	var tree utils.BKTree
+	err = eachPHash(ctx, bson.M{"hash": 1, "phash": 1}, func(image models.Image, value uint64) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		matches := tree.Search(value, threshold)
+		tree.Add(image.Hash, value)
+		if len(matches) == 0 {
+			p.Count(jobs.ItemOK)
+			return nil
+		}
+
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].Distance < matches[j].Distance })
+		related := make([]models.RelatedItem, len(matches))
+		for i, match := range matches {
+			related[i] = models.RelatedItem{Key: match.Key, Distance: match.Distance}
+		}
+		p.Record(models.JobResult{Key: image.Hash, Status: jobs.ItemOK, Related: related})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan images: %v", err)
+	}
+	return nil
+}
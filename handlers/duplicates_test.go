@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/jobs"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+)
+
+// scaledPNG 生成与尺寸无关的同一幅图，不同尺寸的结果感知哈希相近但内容不同
+func scaledPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			fx, fy := x*8/width, y*8/height
+			img.Set(x, y, color.RGBA{uint8(fx * 32), uint8((fx ^ fy) * 32), uint8(fy * 32), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// noisePNG 生成随机噪点图片
+func noisePNG(t *testing.T, seed int64) []byte {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.Intn(256))
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// waitJob 等待任务结束并返回最终状态
+func waitJob(t *testing.T, id string) models.Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := jobs.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("jobs.Get: %v", err)
+		}
+		if job.FinishedAt != nil {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return models.Job{}
+}
+
+func TestSimilarImages(t *testing.T) {
+	testutil.SetupDB(t)
+	testutil.SetupStorage(t, storage.BackendMem)
+	if err := jobs.Init(); err != nil {
+		t.Fatal(err)
+	}
+	phashIndex.mu.Lock()
+	phashIndex.tree = nil
+	phashIndex.mu.Unlock()
+
+	r := newImageRouter()
+	r.POST("/admin/images/duplicates", FindDuplicateImages)
+
+	_, results := upload(t, r, "small.png", scaledPNG(t, 64, 64), nil)
+	if len(results) != 1 || results[0].Status != uploadCreated || len(results[0].Similar) != 0 {
+		t.Fatalf("first upload: %+v", results)
+	}
+	original := results[0].Hash
+	if _, results = upload(t, r, "noise.png", noisePNG(t, 1), nil); results[0].Status != uploadCreated {
+		t.Fatalf("noise upload: %+v", results)
+	}
+
+	// 同一幅图的放大版本内容不同，但会提示相似
+	_, results = upload(t, r, "large.png", scaledPNG(t, 256, 256), nil)
+	if len(results) != 1 || results[0].Status != uploadCreated {
+		t.Fatalf("second upload: %+v", results)
+	}
+	if len(results[0].Similar) != 1 || results[0].Similar[0].Hash != original {
+		t.Fatalf("similar = %+v, want only %s", results[0].Similar, original)
+	}
+	scaled := results[0].Hash
+
+	rec := serve(r, http.MethodPost, "/admin/images/duplicates?threshold=abc")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid threshold: status %d, want 400", rec.Code)
+	}
+
+	rec = serve(r, http.MethodPost, "/admin/images/duplicates")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("submit report: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	var submitted struct {
+		Job struct {
+			ID string `json:"id"`
+		} `json:"job"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &submitted); err != nil || submitted.Job.ID == "" {
+		t.Fatalf("submit response %s: %v", rec.Body.String(), err)
+	}
+
+	job := waitJob(t, submitted.Job.ID)
+	if job.Status != jobs.StatusCompleted || job.Total != 3 || job.Processed != 3 {
+		t.Fatalf("job = %+v", job)
+	}
+	if len(job.Results) != 1 {
+		t.Fatalf("results = %+v, want one entry", job.Results)
+	}
+	result := job.Results[0]
+	if result.Key != scaled || len(result.Related) != 1 || result.Related[0].Key != original {
+		t.Errorf("result = %+v, want %s related to %s", result, scaled, original)
+	}
+}
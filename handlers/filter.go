@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// notDeleted 排除回收站中的图片
+func notDeleted(filter bson.M) bson.M {
+	filter["deletedAt"] = bson.M{"$exists": false}
+	return filter
+}
+
+// buildImageFilter 根据查询参数构造图片过滤条件
+//
+// 支持 tag（可重复，需同时包含）、orientation（landscape/portrait/square）、min_width、min_height、
+// animated（true 只返回动图，false 排除动图）
+func buildImageFilter(c *gin.Context) (bson.M, error) {
+	filter := bson.M{}
+
+	if tags := normalizeTags(c.QueryArray("tag")); len(tags) > 0 {
+		filter["tags"] = bson.M{"$all": tags}
+	}
+
+	switch orientation := c.Query("orientation"); orientation {
+	case "":
+	case "landscape":
+		filter["$expr"] = bson.M{"$gt": bson.A{"$width", "$height"}}
+	case "portrait":
+		filter["$expr"] = bson.M{"$gt": bson.A{"$height", "$width"}}
+	case "square":
+		filter["$expr"] = bson.M{"$eq": bson.A{"$width", "$height"}}
+		filter["width"] = bson.M{"$gt": 0}
+	default:
+		return nil, fmt.Errorf("invalid orientation: %s", orientation)
+	}
+
+	for param, field := range map[string]string{"min_width": "width", "min_height": "height"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s: %s", param, value)
+		}
+		cond, _ := filter[field].(bson.M)
+		if cond == nil {
+			cond = bson.M{}
+		}
+		cond["$gte"] = n
+		filter[field] = cond
+	}
+
+	if value := c.Query("animated"); value != "" {
+		animated, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid animated: %s", value)
+		}
+		if animated {
+			filter["animated"] = true
+		} else {
+			filter["animated"] = bson.M{"$ne": true}
+		}
+	}
+
+	return filter, nil
+}
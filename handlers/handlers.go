@@ -1,16 +1,12 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
-	"crypto/md5"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
-	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"strconv"
@@ -18,90 +14,19 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/jobs"
 	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
 	"pysio.online/blog_api/utils"
 )
 
 var (
-	lastHeartbeat     int64
-	IPINFO_TOKEN      = os.Getenv("IPINFO_TOKEN")
-	application       string
-	introduce         string
-	rgba              string
-	applicationOnline bool
-	minioClient       *minio.Client
-	useMinioStorage   = os.Getenv("USE_MINIO_STORAGE") == "true"
-	minioBucket       = os.Getenv("MINIO_BUCKET")
+	IPINFO_TOKEN = os.Getenv("IPINFO_TOKEN")
 )
 
-func init() {
-	var err error
-	// 检查是否启用了 Minio 存储
-	if useMinioStorage {
-		// 获取所有必需的环境变量
-		endpoint := os.Getenv("MINIO_ENDPOINT")
-		accessKey := os.Getenv("MINIO_ACCESS_KEY")
-		secretKey := os.Getenv("MINIO_SECRET_KEY")
-		bucket := os.Getenv("MINIO_BUCKET")
-
-		// 验证必需的环境变量
-		if endpoint == "" || accessKey == "" || secretKey == "" || bucket == "" {
-			log.Printf("Warning: Missing required Minio environment variables")
-			log.Printf("MINIO_ENDPOINT: %v", endpoint != "")
-			log.Printf("MINIO_ACCESS_KEY: %v", accessKey != "")
-			log.Printf("MINIO_SECRET_KEY: %v", secretKey != "")
-			log.Printf("MINIO_BUCKET: %v", bucket != "")
-			return
-		}
-
-		// 初始化 Minio 客户端
-		minioClient, err = minio.New(endpoint, &minio.Options{
-			Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-			Secure: os.Getenv("MINIO_USE_SSL") == "true",
-			Region: os.Getenv("MINIO_REGION"),
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-				MaxIdleConns:       100,
-				IdleConnTimeout:    90 * time.Second,
-				DisableCompression: true,
-			},
-		})
-		if err != nil {
-			log.Printf("Warning: Failed to initialize Minio client: %v", err)
-			return
-		}
-
-		// 测试连接
-		ctx := context.Background()
-		exists, err := minioClient.BucketExists(ctx, bucket)
-		if err != nil {
-			log.Printf("Warning: Failed to check bucket existence: %v", err)
-			return
-		}
-
-		if !exists {
-			err = minioClient.MakeBucket(ctx, bucket, minio.MakeBucketOptions{
-				Region: os.Getenv("MINIO_REGION"),
-			})
-			if err != nil {
-				log.Printf("Warning: Failed to create bucket: %v", err)
-				return
-			}
-		}
-
-		log.Printf("Successfully initialized Minio client with endpoint: %s", endpoint)
-	} else {
-		log.Printf("Minio storage is disabled")
-	}
-}
-
 func Home(c *gin.Context) {
 	c.String(http.StatusOK, "你来这里干啥 喵?")
 }
@@ -118,73 +43,9 @@ func Fastfetch(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "success", "output": coloredOutput})
 }
 
-func Heartbeat(c *gin.Context) {
-	token := os.Getenv("TOKEN")
-	if token == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "TOKEN environment variable not set",
-			"debug": fmt.Sprintf("Expected: %s, Received: %s",
-				c.GetHeader("Authorization"),
-				fmt.Sprintf("Bearer %s", token)),
-		})
-		return
-	}
-
-	authHeader := c.GetHeader("Authorization")
-	expectedAuth := fmt.Sprintf("Bearer %s", token)
-
-	if authHeader != expectedAuth {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error": "Invalid token",
-			"debug": fmt.Sprintf("Expected: %s, Received: %s",
-				expectedAuth, authHeader),
-		})
-		return
-	}
-
-	application = c.PostForm("application")
-	introduce = c.PostForm("introduce")
-	rgba = c.PostForm("rgba")
-	applicationOnlineStr := c.PostForm("applicationOnline")
-	applicationOnline = applicationOnlineStr == "true"
-
-	lastHeartbeat = time.Now().Unix()
-	c.JSON(http.StatusOK, gin.H{
-		"message":           "Heartbeat received",
-		"application":       application,
-		"introduce":         introduce,
-		"rgba":              rgba,
-		"applicationOnline": applicationOnline,
-	})
-}
-
-func Check(c *gin.Context) {
-	if lastHeartbeat != 0 {
-		timeDiff := time.Now().Unix() - lastHeartbeat
-		response := gin.H{
-			"alive":          timeDiff <= 600,
-			"last_heartbeat": lastHeartbeat,
-		}
-
-		if applicationOnline {
-			response["application"] = application
-			response["introduce"] = introduce
-			response["rgba"] = rgba
-			response["applicationOnline"] = true
-		} else {
-			response["applicationOnline"] = false
-		}
-
-		c.JSON(http.StatusOK, response)
-	} else {
-		c.JSON(http.StatusOK, gin.H{
-			"alive":             false,
-			"last_heartbeat":    nil,
-			"applicationOnline": false,
-		})
-	}
-}
-
+// SteamStatus 返回 Steam 在线和游戏状态
+//
+// Steam API 的密钥在请求地址中，请求失败时的错误信息会包含完整地址，返回前需要去掉机密值
 func SteamStatus(c *gin.Context) {
 	// 在函数内部获取环境变量，而不是使用包级变量
 	steamAPIKey := os.Getenv("STEAM_API_KEY")
@@ -204,7 +65,7 @@ func SteamStatus(c *gin.Context) {
 		steamAPIKey, steamID)
 	resp, err := http.Get(userDetailsUrl)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Steam API request failed: %v", err)})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": utils.Redact(fmt.Sprintf("Steam API request failed: %v", err))})
 		return
 	}
 	defer resp.Body.Close()
@@ -222,7 +83,7 @@ func SteamStatus(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":        "Steam API returned non-JSON response",
 			"content_type": contentType,
-			"response":     string(body),
+			"response":     utils.Redact(string(body)),
 		})
 		return
 	}
@@ -239,7 +100,7 @@ func SteamStatus(c *gin.Context) {
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&userResult); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to decode Steam API response: %v", err)})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": utils.Redact(fmt.Sprintf("Failed to decode Steam API response: %v", err))})
 		return
 	}
 
@@ -255,7 +116,7 @@ func SteamStatus(c *gin.Context) {
 		gameDetailsUrl := fmt.Sprintf("https://store.steampowered.com/api/appdetails?appids=%s&l=schinese&cc=CN", player.GameID)
 		gameResp, err := http.Get(gameDetailsUrl)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": utils.Redact(err.Error())})
 			return
 		}
 		defer gameResp.Body.Close()
@@ -275,7 +136,7 @@ func SteamStatus(c *gin.Context) {
 		}
 
 		if err := json.NewDecoder(gameResp.Body).Decode(&gameResult); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": utils.Redact(err.Error())})
 			return
 		}
 
@@ -283,7 +144,7 @@ func SteamStatus(c *gin.Context) {
 		ownedGamesUrl := fmt.Sprintf("https://api.steampowered.com/IPlayerService/GetOwnedGames/v1/?key=%s&steamid=%s&include_appinfo=1", steamAPIKey, steamID)
 		ownedResp, err := http.Get(ownedGamesUrl)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": utils.Redact(err.Error())})
 			return
 		}
 		defer ownedResp.Body.Close()
@@ -298,7 +159,7 @@ func SteamStatus(c *gin.Context) {
 		}
 
 		if err := json.NewDecoder(ownedResp.Body).Decode(&ownedResult); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": utils.Redact(err.Error())})
 			return
 		}
 
@@ -377,16 +238,20 @@ func IPCheck(c *gin.Context) {
 
 	resp, err := http.Get(fmt.Sprintf("https://ipinfo.io/widget/demo/%s", ip))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": utils.Redact(err.Error())})
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusTooManyRequests {
-		// 使用备用 API
-		resp, err = http.Get(fmt.Sprintf("https://ipinfo.io/%s?token=%s", ip, IPINFO_TOKEN))
+		// 使用备用 API，令牌放在请求头中，避免出现在错误信息里
+		req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, fmt.Sprintf("https://ipinfo.io/%s", url.PathEscape(ip)), nil)
+		if err == nil {
+			req.Header.Set("Authorization", "Bearer "+IPINFO_TOKEN)
+			resp, err = http.DefaultClient.Do(req)
+		}
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": utils.Redact(err.Error())})
 			return
 		}
 		defer resp.Body.Close()
@@ -394,48 +259,13 @@ func IPCheck(c *gin.Context) {
 
 	var result map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "message": utils.Redact(err.Error())})
 		return
 	}
 
 	c.JSON(http.StatusOK, result)
 }
 
-func GetRandomImage(c *gin.Context) {
-	// 只查询 Minio 存储的图片
-	filter := bson.M{"useS3": true}
-
-	// 获取总文档数
-	total, err := models.ImagesCollection.CountDocuments(context.Background(), filter)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get total count: %v", err)})
-		return
-	}
-
-	if total == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No images available"})
-		return
-	}
-
-	// 随机选择一个偏移量
-	skip := rand.Int63n(total)
-
-	// 查找图片
-	var image models.Image
-	err = models.ImagesCollection.FindOne(
-		context.Background(),
-		filter,
-		options.FindOne().SetSkip(skip),
-	).Decode(&image)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get random image: %v", err)})
-		return
-	}
-
-	// 查到随机图片后，改为重定向:
-	c.Redirect(http.StatusTemporaryRedirect, fmt.Sprintf("https://minioapi.pysio.online/randomimg/%s.webp", image.Hash))
-}
-
 type lowerCount struct {
 	Key         string    `json:"key"`
 	Count       int64     `json:"count"`
@@ -492,7 +322,7 @@ func GetAPIStatsByKey(c *gin.Context) {
 }
 
 func GetImageCount(c *gin.Context) {
-	count, err := models.ImagesCollection.CountDocuments(context.Background(), bson.M{})
+	count, err := models.ImagesCollection.CountDocuments(context.Background(), notDeleted(bson.M{}))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -501,150 +331,69 @@ func GetImageCount(c *gin.Context) {
 }
 
 type lowerImage struct {
-	Hash        string    `json:"hash"`
-	Data        []byte    `json:"data"`
-	ContentType string    `json:"contentType"`
-	CreatedAt   time.Time `json:"createdAt"`
+	Hash           string     `json:"hash"`
+	ContentType    string     `json:"contentType"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	Storage        string     `json:"storage"`
+	Width          int        `json:"width,omitempty"`
+	Height         int        `json:"height,omitempty"`
+	Size           int64      `json:"size,omitempty"`
+	OriginalFormat string     `json:"originalFormat,omitempty"`
+	OriginalName   string     `json:"originalName,omitempty"`
+	SourceURL      string     `json:"sourceUrl,omitempty"`
+	DominantColor  string     `json:"dominantColor,omitempty"`
+	BlurHash       string     `json:"blurHash,omitempty"`
+	PHash          string     `json:"phash,omitempty"`
+	Animated       bool       `json:"animated"`
+	FrameCount     int        `json:"frameCount,omitempty"`
+	Duration       int        `json:"duration,omitempty"`
+	CapturedAt     *time.Time `json:"capturedAt,omitempty"`
+	Copyright      string     `json:"copyright,omitempty"`
+	DeletedAt      *time.Time `json:"deletedAt,omitempty"`
+	Tags           []string   `json:"tags"`
+	Title          string     `json:"title,omitempty"`
+	Alt            string     `json:"alt,omitempty"`
 }
 
-func GetImageList(c *gin.Context) {
-	page, _ := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
-	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "10"), 10, 64)
-	skip := (page - 1) * limit
-
-	opts := options.Find().
-		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
-		SetSkip(skip).
-		SetLimit(limit).
-		SetProjection(bson.M{"data": 0}) // 不返回图片数据
-
-	cursor, err := models.ImagesCollection.Find(context.Background(), bson.M{}, opts)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	var images []models.Image
-	if err = cursor.All(context.Background(), &images); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	total, err := models.ImagesCollection.CountDocuments(context.Background(), bson.M{})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+func newLowerImage(img models.Image) lowerImage {
+	tags := img.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return lowerImage{
+		Hash:           img.Hash,
+		ContentType:    img.ContentType,
+		CreatedAt:      img.CreatedAt,
+		Storage:        img.Backend(),
+		Width:          img.Width,
+		Height:         img.Height,
+		Size:           img.Size,
+		OriginalFormat: img.OriginalFormat,
+		OriginalName:   img.OriginalName,
+		SourceURL:      img.SourceURL,
+		DominantColor:  img.DominantColor,
+		BlurHash:       img.BlurHash,
+		PHash:          img.PHash,
+		Animated:       img.Animated,
+		FrameCount:     img.FrameCount,
+		Duration:       img.Duration,
+		CapturedAt:     img.CapturedAt,
+		Copyright:      img.Copyright,
+		DeletedAt:      img.DeletedAt,
+		Tags:           tags,
+		Title:          img.Title,
+		Alt:            img.Alt,
 	}
-
-	// 将 images 转为小写 JSON 字段
-	lowerImages := make([]lowerImage, len(images))
-	for i, img := range images {
-		lowerImages[i] = lowerImage{
-			Hash:        img.Hash,
-			Data:        img.Data,
-			ContentType: img.ContentType,
-			CreatedAt:   img.CreatedAt,
-		}
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"images": lowerImages,
-		"pagination": gin.H{
-			"current": page,
-			"size":    limit,
-			"total":   total,
-		},
-	})
-}
-
-func AddImage(c *gin.Context) {
-	file, err := c.FormFile("image")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Image file is required"})
-		return
-	}
-
-	// 读取文件内容
-	src, err := file.Open()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	defer src.Close()
-
-	buffer := make([]byte, file.Size)
-	if _, err := src.Read(buffer); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	// 验证图片
-	if err := utils.ValidateImage(buffer); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid image: %v", err)})
-		return
-	}
-
-	// 转换为WebP并计算哈希
-	webpBuffer, err := utils.ConvertToWebp(buffer)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert image to WebP"})
-		return
-	}
-
-	hash := fmt.Sprintf("%x", md5.Sum(webpBuffer))
-
-	// 检查是否已存在
-	var existingImage models.Image
-	err = models.ImagesCollection.FindOne(context.Background(), bson.M{"hash": hash}).Decode(&existingImage)
-	if err == nil {
-		c.JSON(http.StatusConflict, gin.H{
-			"error": "Image already exists",
-			"hash":  hash,
-		})
-		return
-	}
-
-	// 在保存到数据库之前，如果启用了 Minio，先保存到 Minio
-	if useMinioStorage {
-		if err := saveImageToMinio(hash, webpBuffer); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save image to Minio: %v", err)})
-			return
-		}
-		// 如果使用 Minio，数据库中就不存储图片数据了
-		webpBuffer = nil
-	}
-
-	// 保存图片信息到数据库
-	image := models.Image{
-		Hash:        hash,
-		Data:        webpBuffer, // 如果使用 Minio，这里是 nil
-		ContentType: "image/webp",
-		CreatedAt:   time.Now(),
-		UseS3:       useMinioStorage,
-	}
-
-	_, err = models.ImagesCollection.InsertOne(context.Background(), image)
-	if err != nil {
-		if useMinioStorage {
-			// 如果数据库保存失败，需要从 Minio 中删除已上传的图片
-			_ = deleteImageFromMinio(hash)
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusCreated, gin.H{
-		"hash": hash,
-		"size": len(webpBuffer),
-	})
 }
 
+// DeleteImage 将图片移入回收站，permanent=true 时立即永久删除
 func DeleteImage(c *gin.Context) {
 	hash := c.Param("hash")
 
 	// 先获取图片信息
 	var image models.Image
-	err := models.ImagesCollection.FindOne(context.Background(), bson.M{"hash": hash}).Decode(&image)
+	err := models.ImagesCollection.FindOne(context.Background(), bson.M{"hash": hash},
+		options.FindOne().SetProjection(bson.M{"data": 0})).Decode(&image)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
@@ -654,108 +403,104 @@ func DeleteImage(c *gin.Context) {
 		return
 	}
 
-	// 如果使用 Minio，先删除 Minio 中的图片
-	if image.UseS3 {
-		if err := deleteImageFromMinio(hash); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete image from Minio: %v", err)})
+	if c.Query("permanent") == "true" {
+		ok, err := purgeImage(context.Background(), bson.M{"hash": hash})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-	}
-
-	// 删除数据库记录
-	result, err := models.ImagesCollection.DeleteOne(context.Background(), bson.M{"hash": hash})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Image deleted permanently"})
 		return
 	}
-	if result.DeletedCount == 0 {
+
+	if image.DeletedAt != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
 		return
 	}
 
-	// 删除缓存
-	utils.DeleteImageFromCache(hash)
+	now := time.Now()
+	_, err = models.ImagesCollection.UpdateOne(context.Background(), notDeleted(bson.M{"hash": hash}),
+		bson.M{"$set": bson.M{"deletedAt": now}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Image deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Image moved to trash",
+		"deletedAt": now,
+		"purgeAt":   now.Add(trashRetention()),
+	})
 }
 
 func GetImage(c *gin.Context) {
-	hash := c.Param("hash")
-
-	// 改为重定向:
-	c.Redirect(http.StatusFound, fmt.Sprintf("https://minioapi.pysio.online/randomimg/%s.webp", hash))
+	serveImage(c, c.Param("hash"))
 }
 
 func GetImageByHash(c *gin.Context) {
-	hash := c.Param("hash")
-
-	// 改为重定向:
-	c.Redirect(http.StatusFound, fmt.Sprintf("https://minioapi.pysio.online/randomimg/%s.webp", hash))
+	serveImage(c, c.Param("hash"))
 }
 
-// 新增刷新缓存的处理函数
+// RefreshCache 在后台任务中将所有图片写入本地缓存
 func RefreshCache(c *gin.Context) {
-	cursor, err := models.ImagesCollection.Find(context.Background(), bson.M{})
+	job, err := jobs.Submit("refresh_cache", nil, refreshCache)
+	respondJobSubmitted(c, job, err)
+}
+
+// refreshCache 逐张读取图片写入缓存，只记录失败的图片
+func refreshCache(ctx context.Context, p *jobs.Progress) error {
+	filter := notDeleted(bson.M{})
+	total, err := models.ImagesCollection.CountDocuments(ctx, filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query images"})
-		return
+		return fmt.Errorf("failed to count images: %v", err)
 	}
-	defer cursor.Close(context.Background())
+	p.SetTotal(int(total))
 
-	var stats struct {
-		Total   int `json:"total"`
-		Cached  int `json:"cached"`
-		Failed  int `json:"failed"`
-		Skipped int `json:"skipped"`
+	cursor, err := models.ImagesCollection.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to query images: %v", err)
 	}
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	for cursor.Next(ctx) {
 		var image models.Image
 		if err := cursor.Decode(&image); err != nil {
-			stats.Failed++
+			p.Record(models.JobResult{Status: jobs.ItemFailed, Reason: err.Error()})
 			continue
 		}
 
-		stats.Total++
-
 		// 如果已经在缓存中，跳过
 		if utils.ImageExistsInCache(image.Hash) {
-			stats.Skipped++
+			p.Count(jobs.ItemSkipped)
 			continue
 		}
 
+		// 从存储后端读取图片数据
+		data := image.Data
+		if len(data) == 0 {
+			store, err := storage.ForImage(&image)
+			if err != nil {
+				p.Record(models.JobResult{Key: image.Hash, Status: jobs.ItemFailed, Reason: err.Error()})
+				continue
+			}
+			if data, err = store.Get(ctx, image.Hash); err != nil {
+				p.Record(models.JobResult{Key: image.Hash, Status: jobs.ItemFailed, Reason: err.Error()})
+				continue
+			}
+		}
+
 		// 保存到缓存
-		if err := utils.SaveImageToCache(image.Hash, image.Data); err != nil {
-			stats.Failed++
+		if err := utils.SaveImageToCache(image.Hash, data); err != nil {
+			p.Record(models.JobResult{Key: image.Hash, Status: jobs.ItemFailed, Reason: err.Error()})
 		} else {
-			stats.Cached++
+			p.Count(jobs.ItemOK)
 		}
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Cache refresh completed",
-		"stats":   stats,
-	})
-}
-
-func CheckSVG(c *gin.Context) {
-	alive := false
-	if lastHeartbeat != 0 {
-		timeDiff := time.Now().Unix() - lastHeartbeat
-		alive = timeDiff <= 600
-	}
-
-	// Base64 编码的脉冲动画图标
-	pulseIcon := "PHN2ZyB4bWxucz0iaHR0cDovL3d3dy53My5vcmcvMjAwMC9zdmciIHdpZHRoPSIxNiIgaGVpZ2h0PSIxNiIgdmlld0JveD0iMCAwIDE2IDE2Ij48Y2lyY2xlIGN4PSI4IiBjeT0iOCIgcj0iNCIgZmlsbD0iIzQ0YzQ3MCIgc3R5bGU9ImFuaW1hdGlvbjogcHVsc2UgMnMgaW5maW5pdGUiPjwvY2lyY2xlPjxzdHlsZT5Aa2V5ZnJhbWVzIHB1bHNlIHswJSB7b3BhY2l0eTogMX01MCUge29wYWNpdHk6IDAuNX0xMDAlIHtvcGFjaXR5OiAxfX08L3N0eWxlPjwvc3ZnPg=="
-
-	var redirectURL string
-	if alive {
-		redirectURL = fmt.Sprintf("https://img.shields.io/badge/Status-Alive-brightgreen?style=for-the-badge&logo=data:image/svg+xml;base64,%s", pulseIcon)
-	} else {
-		redirectURL = fmt.Sprintf("https://img.shields.io/badge/Status-Sleep-9f7be1?style=for-the-badge&logo=data:image/svg+xml;base64,%s", pulseIcon)
-	}
-
-	c.Redirect(http.StatusMovedPermanently, redirectURL)
+	return cursor.Err()
 }
 
 func Egg(c *gin.Context) {
@@ -786,21 +531,3 @@ func parseAnsiColors(text string) string {
 	}
 	return result
 }
-
-func saveImageToMinio(hash string, data []byte) error {
-	if !useMinioStorage {
-		return nil
-	}
-	reader := bytes.NewReader(data)
-	_, err := minioClient.PutObject(context.Background(), minioBucket, hash+".webp", reader, int64(len(data)), minio.PutObjectOptions{
-		ContentType: "image/webp",
-	})
-	return err
-}
-
-func deleteImageFromMinio(hash string) error {
-	if !useMinioStorage {
-		return nil
-	}
-	return minioClient.RemoveObject(context.Background(), minioBucket, hash+".webp", minio.RemoveObjectOptions{})
-}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/utils"
+)
+
+// roundTripFunc 用函数模拟 Steam API，请求不会离开进程
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestSteamStatusDoesNotLeakSecrets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutil.SetSecrets(t)
+	t.Setenv("STEAM_ID", "76561198000000000")
+
+	tests := []struct {
+		name      string
+		roundTrip roundTripFunc
+	}{
+		{
+			// 传输错误（*url.Error）会包含带 key 参数的完整地址
+			name: "transport error",
+			roundTrip: func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			},
+		},
+		{
+			name: "non-json response echoing the request",
+			roundTrip: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": {"text/html"}},
+					Body:       io.NopCloser(strings.NewReader("<html>bad request " + req.URL.String() + "</html>")),
+					Request:    req,
+				}, nil
+			},
+		},
+		{
+			name: "invalid json",
+			roundTrip: func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": {"application/json"}},
+					Body:       io.NopCloser(strings.NewReader(`{"key": "` + req.URL.Query().Get("key"))),
+					Request:    req,
+				}, nil
+			},
+		},
+	}
+
+	transport := http.DefaultTransport
+	t.Cleanup(func() { http.DefaultTransport = transport })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			http.DefaultTransport = tt.roundTrip
+
+			// 与 main 中相同，日志经过 NewRedactingWriter 输出
+			var logs bytes.Buffer
+			log.SetOutput(utils.NewRedactingWriter(&logs))
+			defer log.SetOutput(os.Stderr)
+
+			r := gin.New()
+			r.Use(gin.LoggerWithWriter(utils.NewRedactingWriter(&logs)))
+			r.GET("/steam_status", SteamStatus)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/steam_status", nil))
+
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusInternalServerError, w.Body.String())
+			}
+			testutil.AssertNoSecrets(t, "response body", w.Body.String())
+			testutil.AssertNoSecrets(t, "log output", logs.String())
+		})
+	}
+}
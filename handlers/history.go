@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/utils"
+)
+
+const (
+	defaultPresenceHistoryRetention = 30 * 24 * time.Hour
+	presenceHistoryPurgeInterval    = time.Hour
+	timelineDateLayout              = "2006-01-02"
+)
+
+// presenceHistoryRetention 应用使用记录保留多久，可通过 PRESENCE_HISTORY_RETENTION 配置，为 0 时不记录
+func presenceHistoryRetention() time.Duration {
+	return utils.DurationFromEnv("PRESENCE_HISTORY_RETENTION", defaultPresenceHistoryRetention)
+}
+
+// privateApps 不公开的应用名称，通过 PRESENCE_PRIVATE_APPS 配置，逗号分隔，不区分大小写
+func privateApps() []string {
+	var names []string
+	for _, name := range strings.Split(os.Getenv("PRESENCE_PRIVATE_APPS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func isPrivateApp(application string) bool {
+	for _, name := range privateApps() {
+		if strings.EqualFold(name, application) {
+			return true
+		}
+	}
+	return false
+}
+
+// publicSessionFilter 排除不公开应用的查询条件，加入列表之前记录的时段同样不会返回
+func publicSessionFilter() bson.M {
+	names := privateApps()
+	if len(names) == 0 {
+		return bson.M{}
+	}
+	patterns := make(bson.A, len(names))
+	for i, name := range names {
+		patterns[i] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(name) + "$", Options: "i"}
+	}
+	return bson.M{"application": bson.M{"$nin": patterns}}
+}
+
+// presenceLocation 按天统计使用的时区，可通过 PRESENCE_TIMEZONE 配置（如 "Asia/Shanghai"），默认使用服务器时区
+func presenceLocation() *time.Location {
+	if name := os.Getenv("PRESENCE_TIMEZONE"); name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// saveHeartbeat 保存设备的心跳，并根据更新前的设备记录维护应用使用时段，返回保存后的设备记录
+//
+// 设备记录通过一次 FindOneAndUpdate 读取并替换，同一设备并发的心跳会依次看到彼此的结果，不会重复开始时段。
+// 同一设备在离线判定时间内持续上报同一个应用时延长原时段；切换应用或应用离开前台时，原时段在本次心跳时结束
+func saveHeartbeat(ctx context.Context, device models.Device) (models.Device, error) {
+	// MongoDB 中的时间精度为毫秒，截断后数据库和这里对离线判定的结果一致
+	now := device.LastHeartbeat.Truncate(time.Millisecond)
+	device.LastHeartbeat = now
+	cutoff := now.Add(-presenceStaleAfter())
+	tracked := presenceHistoryRetention() > 0 &&
+		device.ApplicationOnline &&
+		device.Application != "" &&
+		!isPrivateApp(device.Application)
+
+	// 与下面根据更新前记录做出的判断保持一致
+	var sessionID interface{} = "$$REMOVE"
+	newSessionID := primitive.NewObjectID()
+	if tracked {
+		sessionID = bson.M{"$cond": bson.A{
+			bson.M{"$and": bson.A{
+				bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$sessionId", nil}}, nil}},
+				bson.M{"$eq": bson.A{"$application", bson.M{"$literal": device.Application}}},
+				bson.M{"$gte": bson.A{"$lastHeartbeat", cutoff}},
+			}},
+			"$sessionId",
+			newSessionID,
+		}}
+	}
+
+	// 整体替换设备记录，本次没有上报的电量信息会被清除；上报的内容可能以 $ 开头，需要作为字面值写入
+	var battery, charging interface{} = "$$REMOVE", "$$REMOVE"
+	if device.Battery != nil {
+		battery = *device.Battery
+	}
+	if device.Charging != nil {
+		charging = *device.Charging
+	}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"application":       bson.M{"$literal": device.Application},
+		"introduce":         bson.M{"$literal": device.Introduce},
+		"rgba":              bson.M{"$literal": device.RGBA},
+		"applicationOnline": device.ApplicationOnline,
+		"battery":           battery,
+		"charging":          charging,
+		"lastHeartbeat":     now,
+		"sessionId":         sessionID,
+	}}}}
+	var previous models.Device
+	err := models.DevicesCollection.FindOneAndUpdate(ctx, bson.M{"_id": device.ID}, update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return device, err
+	}
+
+	fresh := previous.SessionID != nil && !previous.LastHeartbeat.Before(cutoff)
+	continued := fresh && tracked && previous.Application == device.Application
+	switch {
+	case continued:
+		device.SessionID = previous.SessionID
+	case tracked:
+		device.SessionID = &newSessionID
+	}
+
+	// 记录历史失败不影响在线状态的更新
+	if fresh && !continued {
+		if _, err := models.SessionsCollection.UpdateOne(ctx,
+			bson.M{"_id": *previous.SessionID},
+			bson.M{"$max": bson.M{"end": now}}); err != nil {
+			log.Printf("Failed to close presence session for %s: %v", device.ID, err)
+		}
+	}
+	if device.SessionID != nil {
+		// 并发的心跳可能先于创建者写入同一个时段，原时段也可能已被清理，统一使用 upsert
+		_, err := models.SessionsCollection.UpdateOne(ctx,
+			bson.M{"_id": *device.SessionID},
+			bson.M{
+				"$setOnInsert": bson.M{"device": device.ID, "application": device.Application},
+				"$min":         bson.M{"start": now},
+				"$max":         bson.M{"end": now},
+			},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			log.Printf("Failed to record presence session for %s: %v", device.ID, err)
+		}
+	}
+	return device, nil
+}
+
+// StartPresenceHistoryPurger 在后台定期删除超过保留时长的应用使用记录
+func StartPresenceHistoryPurger() {
+	if presenceHistoryRetention() <= 0 {
+		log.Printf("Presence history disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(presenceHistoryPurgeInterval)
+		defer ticker.Stop()
+		for {
+			before := time.Now().Add(-presenceHistoryRetention())
+			result, err := models.SessionsCollection.DeleteMany(context.Background(), bson.M{"end": bson.M{"$lt": before}})
+			if err != nil {
+				log.Printf("Failed to purge presence history: %v", err)
+			} else if result.DeletedCount > 0 {
+				log.Printf("Purged %d presence sessions", result.DeletedCount)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+type lowerSession struct {
+	ID          string `json:"id"`
+	Device      string `json:"device"`
+	Application string `json:"application"`
+	Start       int64  `json:"start"`
+	End         int64  `json:"end"`
+	// Duration 时长（秒）
+	Duration int64 `json:"duration"`
+}
+
+func newLowerSession(session models.PresenceSession) lowerSession {
+	return lowerSession{
+		ID:          session.ID.Hex(),
+		Device:      session.Device,
+		Application: session.Application,
+		Start:       session.Start.Unix(),
+		End:         session.End.Unix(),
+		Duration:    int64(session.End.Sub(session.Start).Seconds()),
+	}
+}
+
+// CheckHistory 按开始时间倒序列出应用使用时段，before 为上一页最后一条的 id
+func CheckHistory(c *gin.Context) {
+	limit := defaultListLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit: must be between 1 and %d", maxListLimit)})
+			return
+		}
+		limit = n
+	}
+
+	filter := publicSessionFilter()
+	if device := c.Query("device"); device != "" {
+		filter["device"] = device
+	}
+	if before := c.Query("before"); before != "" {
+		id, err := primitive.ObjectIDFromHex(before)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid before: %s", before)})
+			return
+		}
+		filter["_id"] = bson.M{"$lt": id}
+	}
+
+	// 时段在开始时插入，按 _id 排序即按开始时间排序；多取一条用于判断是否还有下一页
+	ctx := c.Request.Context()
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit + 1))
+	cursor, err := models.SessionsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var sessions []models.PresenceSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{}
+	if len(sessions) > limit {
+		sessions = sessions[:limit]
+		response["next"] = sessions[limit-1].ID.Hex()
+	}
+	results := make([]lowerSession, len(sessions))
+	for i, session := range sessions {
+		results[i] = newLowerSession(session)
+	}
+	response["sessions"] = results
+	c.JSON(http.StatusOK, response)
+}
+
+type timelineApplication struct {
+	Application string `json:"application"`
+	// Duration 当天的总时长（秒）
+	Duration int64 `json:"duration"`
+	Sessions int   `json:"sessions"`
+}
+
+// CheckTimeline 统计某一天每个应用的使用时长，跨天的时段按当天的部分计算
+//
+// date 格式为 2006-01-02，默认为今天；多台设备同时使用同一个应用时时长直接相加
+func CheckTimeline(c *gin.Context) {
+	loc := presenceLocation()
+	now := time.Now().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if value := c.Query("date"); value != "" {
+		parsed, err := time.ParseInLocation(timelineDateLayout, value, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date: must be in YYYY-MM-DD format"})
+			return
+		}
+		day = parsed
+	}
+	dayEnd := day.AddDate(0, 0, 1)
+
+	filter := publicSessionFilter()
+	filter["start"] = bson.M{"$lt": dayEnd}
+	filter["end"] = bson.M{"$gt": day}
+	if device := c.Query("device"); device != "" {
+		filter["device"] = device
+	}
+
+	ctx := c.Request.Context()
+	cursor, err := models.SessionsCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "start", Value: 1}}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var sessions []models.PresenceSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int64
+	byApp := make(map[string]*timelineApplication)
+	results := make([]lowerSession, len(sessions))
+	for i, session := range sessions {
+		if session.Start.Before(day) {
+			session.Start = day
+		}
+		if session.End.After(dayEnd) {
+			session.End = dayEnd
+		}
+		lower := newLowerSession(session)
+		results[i] = lower
+
+		app, ok := byApp[session.Application]
+		if !ok {
+			app = &timelineApplication{Application: session.Application}
+			byApp[session.Application] = app
+		}
+		app.Duration += lower.Duration
+		app.Sessions++
+		total += lower.Duration
+	}
+
+	applications := make([]timelineApplication, 0, len(byApp))
+	for _, app := range byApp {
+		applications = append(applications, *app)
+	}
+	sort.Slice(applications, func(i, j int) bool {
+		if applications[i].Duration != applications[j].Duration {
+			return applications[i].Duration > applications[j].Duration
+		}
+		return applications[i].Application < applications[j].Application
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"date":         day.Format(timelineDateLayout),
+		"timezone":     loc.String(),
+		"total":        total,
+		"applications": applications,
+		"sessions":     results,
+	})
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/models"
+)
+
+type historyResponse struct {
+	Sessions []lowerSession `json:"sessions"`
+	Next     string         `json:"next"`
+}
+
+func TestHeartbeatRecordsSessions(t *testing.T) {
+	testutil.SetupDB(t)
+	t.Setenv("PRESENCE_STALE_AFTER", "10m")
+	t.Setenv("PRESENCE_PRIVATE_APPS", "Secret")
+	r := newPresenceRouter()
+	ctx := context.Background()
+
+	sessions := func() []models.PresenceSession {
+		t.Helper()
+		var result []models.PresenceSession
+		cursor, err := models.SessionsCollection.Find(ctx, bson.M{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cursor.All(ctx, &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	beat := func(application string) {
+		t.Helper()
+		fields := map[string]string{"device": "phone", "application": application, "applicationOnline": "true"}
+		if code := heartbeat(t, r, fields); code != http.StatusOK {
+			t.Fatalf("heartbeat %s: status %d", application, code)
+		}
+	}
+
+	// 持续上报同一个应用时延长原时段
+	beat("Editor")
+	beat("Editor")
+	if s := sessions(); len(s) != 1 || s[0].Application != "Editor" || s[0].Device != "phone" {
+		t.Fatalf("sessions after repeated heartbeats: %+v", s)
+	}
+
+	// 切换应用时结束原时段
+	beat("Browser")
+	var device models.Device
+	if err := models.DevicesCollection.FindOne(ctx, bson.M{"_id": "phone"}).Decode(&device); err != nil || device.SessionID == nil {
+		t.Fatalf("device session: %+v, %v", device, err)
+	}
+	var editor models.PresenceSession
+	if err := models.SessionsCollection.FindOne(ctx, bson.M{"application": "Editor"}).Decode(&editor); err != nil {
+		t.Fatal(err)
+	}
+	if editor.End.Before(editor.Start) || editor.End.After(device.LastHeartbeat) {
+		t.Errorf("editor session %s - %s, switched at %s", editor.Start, editor.End, device.LastHeartbeat)
+	}
+	if len(sessions()) != 2 {
+		t.Fatalf("switching applications did not start a new session")
+	}
+
+	// 超过离线判定时间后重新开始时段
+	ageDevice(t, "phone", 11*time.Minute)
+	beat("Browser")
+	if n := len(sessions()); n != 3 {
+		t.Fatalf("%d sessions after a stale heartbeat, want 3", n)
+	}
+
+	// 不公开的应用和不在前台的应用不记录
+	beat("Secret")
+	if code := heartbeat(t, r, map[string]string{"device": "phone", "application": "Browser"}); code != http.StatusOK {
+		t.Fatalf("heartbeat: status %d", code)
+	}
+	if n := len(sessions()); n != 3 {
+		t.Errorf("%d sessions after private and background heartbeats, want 3", n)
+	}
+	device = models.Device{}
+	if err := models.DevicesCollection.FindOne(ctx, bson.M{"_id": "phone"}).Decode(&device); err != nil || device.SessionID != nil {
+		t.Errorf("device still has a session: %+v, %v", device, err)
+	}
+
+	// 加入不公开列表之前记录的时段同样不返回
+	if _, err := models.SessionsCollection.InsertOne(ctx, models.PresenceSession{
+		Device: "phone", Application: "secret", Start: time.Now(), End: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var page historyResponse
+	if code := requestJSON(t, r, http.MethodGet, "/check/history?limit=2", nil, &page); code != http.StatusOK {
+		t.Fatalf("history: status %d", code)
+	}
+	if len(page.Sessions) != 2 || page.Next == "" || page.Sessions[0].Application != "Browser" || page.Sessions[1].Application != "Browser" {
+		t.Fatalf("first page: %+v", page)
+	}
+	var next historyResponse
+	requestJSON(t, r, http.MethodGet, "/check/history?limit=2&before="+page.Next, nil, &next)
+	if len(next.Sessions) != 1 || next.Next != "" || next.Sessions[0].Application != "Editor" {
+		t.Errorf("second page: %+v", next)
+	}
+	var other historyResponse
+	requestJSON(t, r, http.MethodGet, "/check/history?device=laptop", nil, &other)
+	if len(other.Sessions) != 0 {
+		t.Errorf("history for another device: %+v", other)
+	}
+
+	for _, query := range []string{"limit=0", "limit=abc", "before=zz"} {
+		if code := requestJSON(t, r, http.MethodGet, "/check/history?"+query, nil, nil); code != http.StatusBadRequest {
+			t.Errorf("history?%s: status %d, want 400", query, code)
+		}
+	}
+}
+
+func TestCheckTimeline(t *testing.T) {
+	testutil.SetupDB(t)
+	t.Setenv("PRESENCE_TIMEZONE", "Asia/Shanghai")
+	t.Setenv("PRESENCE_PRIVATE_APPS", "Secret")
+	r := newPresenceRouter()
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.January, day, hour, minute, 0, 0, loc)
+	}
+	var docs []interface{}
+	for _, s := range []models.PresenceSession{
+		{Device: "phone", Application: "Editor", Start: at(1, 23, 0), End: at(2, 1, 0)},
+		{Device: "laptop", Application: "Editor", Start: at(2, 10, 0), End: at(2, 10, 30)},
+		{Device: "phone", Application: "Browser", Start: at(2, 12, 0), End: at(2, 14, 0)},
+		{Device: "phone", Application: "Secret", Start: at(2, 15, 0), End: at(2, 16, 0)},
+		{Device: "phone", Application: "Browser", Start: at(3, 9, 0), End: at(3, 10, 0)},
+	} {
+		docs = append(docs, s)
+	}
+	if _, err := models.SessionsCollection.InsertMany(context.Background(), docs); err != nil {
+		t.Fatal(err)
+	}
+
+	var timeline struct {
+		Date         string                `json:"date"`
+		Timezone     string                `json:"timezone"`
+		Total        int64                 `json:"total"`
+		Applications []timelineApplication `json:"applications"`
+		Sessions     []lowerSession        `json:"sessions"`
+	}
+	if code := requestJSON(t, r, http.MethodGet, "/check/timeline?date=2026-01-02", nil, &timeline); code != http.StatusOK {
+		t.Fatalf("timeline: status %d", code)
+	}
+	if timeline.Date != "2026-01-02" || timeline.Timezone != "Asia/Shanghai" || timeline.Total != 12600 {
+		t.Errorf("timeline: %+v", timeline)
+	}
+	want := []timelineApplication{{Application: "Browser", Duration: 7200, Sessions: 1}, {Application: "Editor", Duration: 5400, Sessions: 2}}
+	if len(timeline.Applications) != len(want) || timeline.Applications[0] != want[0] || timeline.Applications[1] != want[1] {
+		t.Errorf("applications = %+v, want %+v", timeline.Applications, want)
+	}
+	// 跨天的时段只计算当天的部分
+	if len(timeline.Sessions) != 3 || timeline.Sessions[0].Start != at(2, 0, 0).Unix() || timeline.Sessions[0].Duration != 3600 {
+		t.Errorf("sessions = %+v", timeline.Sessions)
+	}
+
+	requestJSON(t, r, http.MethodGet, "/check/timeline?date=2026-01-02&device=laptop", nil, &timeline)
+	if timeline.Total != 1800 {
+		t.Errorf("laptop total = %d, want 1800", timeline.Total)
+	}
+	if code := requestJSON(t, r, http.MethodGet, "/check/timeline?date=01/02/2026", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("invalid date: status %d, want 400", code)
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"pysio.online/blog_api/jobs"
+	"pysio.online/blog_api/models"
+)
+
+const (
+	defaultJobListLimit = 20
+	maxJobListLimit     = 100
+)
+
+type jobResult struct {
+	Key     string        `json:"key"`
+	Status  string        `json:"status"`
+	Reason  string        `json:"reason,omitempty"`
+	Related []relatedItem `json:"related,omitempty"`
+}
+
+type relatedItem struct {
+	Key      string `json:"key"`
+	Distance int    `json:"distance"`
+}
+
+type jobResponse struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Status     string                 `json:"status"`
+	Params     map[string]interface{} `json:"params,omitempty"`
+	Total      int                    `json:"total"`
+	Processed  int                    `json:"processed"`
+	Succeeded  int                    `json:"succeeded"`
+	Skipped    int                    `json:"skipped"`
+	Failed     int                    `json:"failed"`
+	Results    []jobResult            `json:"results,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	CreatedAt  time.Time              `json:"createdAt"`
+	StartedAt  *time.Time             `json:"startedAt,omitempty"`
+	FinishedAt *time.Time             `json:"finishedAt,omitempty"`
+	UpdatedAt  time.Time              `json:"updatedAt"`
+}
+
+func newJobResponse(job models.Job) jobResponse {
+	results := make([]jobResult, len(job.Results))
+	for i, r := range job.Results {
+		results[i] = jobResult{Key: r.Key, Status: r.Status, Reason: r.Reason}
+		for _, item := range r.Related {
+			results[i].Related = append(results[i].Related, relatedItem{Key: item.Key, Distance: item.Distance})
+		}
+	}
+	return jobResponse{
+		ID:         job.ID,
+		Type:       job.Type,
+		Status:     job.Status,
+		Params:     job.Params,
+		Total:      job.Total,
+		Processed:  job.Processed,
+		Succeeded:  job.Succeeded,
+		Skipped:    job.Skipped,
+		Failed:     job.Failed,
+		Results:    results,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+		UpdatedAt:  job.UpdatedAt,
+	}
+}
+
+// respondJobError 统一处理任务查询错误
+func respondJobError(c *gin.Context, err error) {
+	switch err {
+	case jobs.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+	case jobs.ErrNotActive:
+		c.JSON(http.StatusConflict, gin.H{"error": "Job is not queued or running"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// ListJobs 按创建时间倒序列出后台任务，可按 status 过滤
+func ListJobs(c *gin.Context) {
+	limit := defaultJobListLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxJobListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit: must be between 1 and %d", maxJobListLimit)})
+			return
+		}
+		limit = n
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", jobs.StatusQueued, jobs.StatusRunning, jobs.StatusCompleted, jobs.StatusFailed, jobs.StatusCanceled:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid status: %s", status)})
+		return
+	}
+
+	list, err := jobs.List(c.Request.Context(), status, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	results := make([]jobResponse, len(list))
+	for i, job := range list {
+		results[i] = newJobResponse(job)
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": results})
+}
+
+// GetJob 返回任务进度和逐条结果
+func GetJob(c *gin.Context) {
+	job, err := jobs.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newJobResponse(job))
+}
+
+// CancelJob 取消排队中或运行中的任务，已处理的条目不会回滚
+func CancelJob(c *gin.Context) {
+	id := c.Param("id")
+	if err := jobs.Cancel(c.Request.Context(), id); err != nil {
+		respondJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Job cancellation requested", "id": id})
+}
+
+// respondJobSubmitted 任务创建成功后返回 202
+func respondJobSubmitted(c *gin.Context, job models.Job, err error) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create job: %v", err)})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Job started", "job": newJobResponse(job)})
+}
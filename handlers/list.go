@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/models"
+)
+
+const (
+	defaultListLimit = 10
+	maxListLimit     = 100
+)
+
+// listFields 可通过 fields 参数选择的字段，值为对应的数据库字段
+var listFields = map[string][]string{
+	"hash":           {"hash"},
+	"contentType":    {"contentType"},
+	"createdAt":      {"createdAt"},
+	"storage":        {"storage", "useS3"},
+	"width":          {"width"},
+	"height":         {"height"},
+	"size":           {"size"},
+	"originalFormat": {"originalFormat"},
+	"originalName":   {"originalName"},
+	"sourceUrl":      {"sourceUrl"},
+	"dominantColor":  {"dominantColor"},
+	"blurHash":       {"blurHash"},
+	"phash":          {"phash"},
+	"animated":       {"animated"},
+	"frameCount":     {"frameCount"},
+	"duration":       {"duration"},
+	"capturedAt":     {"capturedAt"},
+	"copyright":      {"copyright"},
+	"tags":           {"tags"},
+	"title":          {"title"},
+	"alt":            {"alt"},
+}
+
+// encodeListCursor 游标由创建时间（毫秒）和 hash 组成，保证排序稳定
+func encodeListCursor(img models.Image) string {
+	raw := fmt.Sprintf("%d:%s", img.CreatedAt.UnixMilli(), img.Hash)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeListCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+	millis, hash, ok := strings.Cut(string(raw), ":")
+	if !ok || hash == "" {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, "", errors.New("invalid cursor")
+	}
+	return time.UnixMilli(ms).UTC(), hash, nil
+}
+
+// parseListTime 支持 RFC3339 和 YYYY-MM-DD，日期格式作为结束时间时包含当天
+func parseListTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// buildImageListFilter 在 buildImageFilter 的基础上增加时间范围和存储后端过滤
+func buildImageListFilter(c *gin.Context) (bson.M, error) {
+	filter, err := buildImageFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	notDeleted(filter)
+
+	createdAt := bson.M{}
+	if from := c.Query("from"); from != "" {
+		t, err := parseListTime(from, false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from: %s", from)
+		}
+		createdAt["$gte"] = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseListTime(to, true)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to: %s", to)
+		}
+		createdAt["$lt"] = t
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+
+	if backend := c.Query("storage"); backend != "" {
+		switch backend {
+		case "mongo", "s3", "local", "memory":
+		default:
+			return nil, fmt.Errorf("invalid storage: %s", backend)
+		}
+		filter = bson.M{"$and": bson.A{filter, models.StorageFilter(backend)}}
+	}
+
+	return filter, nil
+}
+
+// parseListFields 解析 fields 参数，返回字段列表和数据库投影
+func parseListFields(value string) ([]string, bson.M, error) {
+	if value == "" {
+		return nil, bson.M{"data": 0}, nil
+	}
+
+	// hash 和 createdAt 用于生成游标，始终查询
+	projection := bson.M{"hash": 1, "createdAt": 1}
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		columns, ok := listFields[field]
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid field: %s", field)
+		}
+		for _, column := range columns {
+			projection[column] = 1
+		}
+		fields = append(fields, field)
+	}
+	return fields, projection, nil
+}
+
+// selectFields 只保留请求的字段
+func selectFields(img lowerImage, fields []string) (gin.H, error) {
+	raw, err := json.Marshal(img)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]interface{}
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil, err
+	}
+	selected := gin.H{}
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	return selected, nil
+}
+
+// GetImageList 按创建时间分页列出图片
+//
+// 使用 cursor 游标翻页，支持 limit、sort（newest/oldest）、from/to、tag、storage 等过滤条件，
+// fields 可以只返回部分字段
+func GetImageList(c *gin.Context) {
+	limit := defaultListLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit: must be between 1 and %d", maxListLimit)})
+			return
+		}
+		limit = n
+	}
+
+	direction := -1
+	switch sort := c.DefaultQuery("sort", "newest"); sort {
+	case "newest":
+	case "oldest":
+		direction = 1
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid sort: %s", sort)})
+		return
+	}
+
+	filter, err := buildImageListFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fields, projection, err := parseListFields(c.Query("fields"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		createdAt, hash, err := decodeListCursor(cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		op := "$lt"
+		if direction == 1 {
+			op = "$gt"
+		}
+		after := bson.M{"$or": bson.A{
+			bson.M{"createdAt": bson.M{op: createdAt}},
+			bson.M{"createdAt": createdAt, "hash": bson.M{op: hash}},
+		}}
+		filter = bson.M{"$and": bson.A{filter, after}}
+	}
+
+	// 多取一条用于判断是否还有下一页
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: direction}, {Key: "hash", Value: direction}}).
+		SetLimit(int64(limit + 1)).
+		SetProjection(projection)
+
+	ctx := c.Request.Context()
+	cursor, err := models.ImagesCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var images []models.Image
+	if err = cursor.All(ctx, &images); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	hasMore := len(images) > limit
+	if hasMore {
+		images = images[:limit]
+	}
+
+	var nextCursor interface{}
+	if hasMore {
+		nextCursor = encodeListCursor(images[len(images)-1])
+	}
+
+	results := make([]interface{}, len(images))
+	for i, img := range images {
+		if fields == nil {
+			results[i] = newLowerImage(img)
+			continue
+		}
+		selected, err := selectFields(newLowerImage(img), fields)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		results[i] = selected
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"images": results,
+		"pagination": gin.H{
+			"limit":      limit,
+			"nextCursor": nextCursor,
+			"hasMore":    hasMore,
+		},
+	})
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/jobs"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/utils"
+)
+
+const maxTagLength = 64
+
+// normalizeTags 支持逗号分隔，统一转为小写并去重
+func normalizeTags(values []string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag == "" || len(tag) > maxTagLength || seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// findImageMeta 查询图片记录（不含图片数据），回收站中的图片视为不存在
+func findImageMeta(ctx context.Context, hash string) (models.Image, error) {
+	var image models.Image
+	err := models.ImagesCollection.FindOne(ctx, notDeleted(bson.M{"hash": hash}),
+		options.FindOne().SetProjection(bson.M{"data": 0})).Decode(&image)
+	return image, err
+}
+
+// missingInfoFilter 匹配上传时没有记录尺寸或感知哈希的旧图片
+func missingInfoFilter() bson.M {
+	return notDeleted(bson.M{"$or": bson.A{
+		bson.M{"phash": bson.M{"$exists": false}},
+		bson.M{"phash": ""},
+		bson.M{"width": bson.M{"$exists": false}},
+		bson.M{"width": 0},
+	}})
+}
+
+// BackfillImageInfo 在后台任务中为旧图片补充尺寸、主色调、BlurHash 和感知哈希
+func BackfillImageInfo(c *gin.Context) {
+	job, err := jobs.Submit("backfill_image_info", nil, backfillImagesInfo)
+	respondJobSubmitted(c, job, err)
+}
+
+// backfillImagesInfo 逐张读取缺少元数据的图片并补充，只记录失败的图片
+func backfillImagesInfo(ctx context.Context, p *jobs.Progress) error {
+	filter := missingInfoFilter()
+	total, err := models.ImagesCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to count images: %v", err)
+	}
+	p.SetTotal(int(total))
+
+	cursor, err := models.ImagesCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"data": 0}))
+	if err != nil {
+		return fmt.Errorf("failed to query images: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var image models.Image
+		if err := cursor.Decode(&image); err != nil {
+			p.Record(models.JobResult{Status: jobs.ItemFailed, Reason: err.Error()})
+			continue
+		}
+		if err := backfillImageInfo(ctx, &image); err != nil {
+			p.Record(models.JobResult{Key: image.Hash, Status: jobs.ItemFailed, Reason: err.Error()})
+			continue
+		}
+		p.Count(jobs.ItemOK)
+	}
+	return cursor.Err()
+}
+
+// backfillImageInfo 为缺少尺寸信息的旧图片补充元数据
+func backfillImageInfo(ctx context.Context, image *models.Image) error {
+	data, err := loadImageData(ctx, image)
+	if err != nil {
+		return err
+	}
+	info, err := utils.AnalyzeImage(data)
+	if err != nil {
+		return err
+	}
+
+	image.Width = info.Width
+	image.Height = info.Height
+	image.Size = int64(len(data))
+	image.DominantColor = info.DominantColor
+	image.BlurHash = info.BlurHash
+	image.PHash = info.PHash
+
+	_, err = models.ImagesCollection.UpdateOne(ctx, bson.M{"hash": image.Hash}, bson.M{
+		"$set": bson.M{
+			"width":         image.Width,
+			"height":        image.Height,
+			"size":          image.Size,
+			"dominantColor": image.DominantColor,
+			"blurHash":      image.BlurHash,
+			"phash":         image.PHash,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	addToPHashIndex(image.Hash, image.PHash)
+	return nil
+}
+
+func GetImageMeta(c *gin.Context) {
+	ctx := c.Request.Context()
+	image, err := findImageMeta(ctx, c.Param("hash"))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 只读取记录，旧图片缺少的尺寸等信息由 BackfillImageInfo 任务补充
+	c.JSON(http.StatusOK, newLowerImage(image))
+}
+
+type updateImageMetaRequest struct {
+	Tags  *[]string `json:"tags"`
+	Title *string   `json:"title"`
+	Alt   *string   `json:"alt"`
+}
+
+func UpdateImageMeta(c *gin.Context) {
+	var req updateImageMetaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	set := bson.M{}
+	if req.Tags != nil {
+		set["tags"] = normalizeTags(*req.Tags)
+	}
+	if req.Title != nil {
+		set["title"] = strings.TrimSpace(*req.Title)
+	}
+	if req.Alt != nil {
+		set["alt"] = strings.TrimSpace(*req.Alt)
+	}
+	if len(set) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	hash := c.Param("hash")
+	result, err := models.ImagesCollection.UpdateOne(ctx, notDeleted(bson.M{"hash": hash}), bson.M{"$set": set})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+
+	image, err := findImageMeta(ctx, hash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newLowerImage(image))
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/jobs"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+)
+
+func TestImageMetaIsReadOnlyAndBackfilledByJob(t *testing.T) {
+	testutil.SetupDB(t)
+	testutil.SetupStorage(t, storage.BackendMem)
+	if err := jobs.Init(); err != nil {
+		t.Fatal(err)
+	}
+	r := newImageRouter()
+	r.GET("/images/:hash/meta", GetImageMeta)
+	r.POST("/admin/images/backfill", BackfillImageInfo)
+	ctx := context.Background()
+
+	_, results := upload(t, r, "gradient.png", testPNG(t, 40, 30, 2), nil)
+	if len(results) != 1 || results[0].Status != uploadCreated {
+		t.Fatalf("upload failed: %+v", results)
+	}
+	hash := results[0].Hash
+
+	// 模拟上传时没有记录元数据的旧图片
+	_, err := models.ImagesCollection.UpdateOne(ctx, bson.M{"hash": hash},
+		bson.M{"$unset": bson.M{"width": "", "height": "", "size": "", "blurHash": "", "phash": ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(r, http.MethodGet, "/images/"+hash+"/meta")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get meta: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	var stored models.Image
+	if err := models.ImagesCollection.FindOne(ctx, bson.M{"hash": hash}).Decode(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Width != 0 || stored.PHash != "" {
+		t.Fatalf("GET meta wrote to the record: width %d, phash %q", stored.Width, stored.PHash)
+	}
+
+	rec = serve(r, http.MethodPost, "/admin/images/backfill")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("submit backfill: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	var submitted struct {
+		Job struct {
+			ID string `json:"id"`
+		} `json:"job"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &submitted)
+	job := waitJob(t, submitted.Job.ID)
+	if job.Status != jobs.StatusCompleted || job.Total != 1 || job.Succeeded != 1 {
+		t.Fatalf("backfill job = %+v", job)
+	}
+
+	if err := models.ImagesCollection.FindOne(ctx, bson.M{"hash": hash}).Decode(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Width != 40 || stored.Height != 30 || stored.PHash == "" || stored.Size == 0 {
+		t.Errorf("record after backfill: %dx%d size %d phash %q", stored.Width, stored.Height, stored.Size, stored.PHash)
+	}
+}
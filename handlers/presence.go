@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/utils"
+)
+
+const (
+	defaultPresenceStaleAfter = 600 * time.Second
+	// 未指定 device 的旧客户端共用的设备 ID
+	defaultDeviceID = "default"
+)
+
+var deviceIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// presenceStaleAfter 超过多久没有心跳视为离线，可通过 PRESENCE_STALE_AFTER 配置（如 "10m"）
+func presenceStaleAfter() time.Duration {
+	d := utils.DurationFromEnv("PRESENCE_STALE_AFTER", defaultPresenceStaleAfter)
+	if d <= 0 {
+		return defaultPresenceStaleAfter
+	}
+	return d
+}
+
+type lowerDevice struct {
+	Device            string `json:"device"`
+	Alive             bool   `json:"alive"`
+	LastHeartbeat     int64  `json:"last_heartbeat"`
+	ApplicationOnline bool   `json:"applicationOnline"`
+	Application       string `json:"application,omitempty"`
+	Introduce         string `json:"introduce,omitempty"`
+	RGBA              string `json:"rgba,omitempty"`
+	Battery           *int   `json:"battery,omitempty"`
+	Charging          *bool  `json:"charging,omitempty"`
+}
+
+func newLowerDevice(device models.Device, now time.Time, staleAfter time.Duration) lowerDevice {
+	lower := lowerDevice{
+		Device:            device.ID,
+		Alive:             now.Sub(device.LastHeartbeat) <= staleAfter,
+		LastHeartbeat:     device.LastHeartbeat.Unix(),
+		ApplicationOnline: device.ApplicationOnline,
+		Battery:           device.Battery,
+		Charging:          device.Charging,
+	}
+	// 应用不在前台或属于不公开的应用时不展示应用信息
+	if device.ApplicationOnline && !isPrivateApp(device.Application) {
+		lower.Application = device.Application
+		lower.Introduce = device.Introduce
+		lower.RGBA = device.RGBA
+	}
+	return lower
+}
+
+// presenceResponse /check 的响应
+//
+// 顶层字段与单设备时的格式保持兼容，取自最近一次心跳的设备
+type presenceResponse struct {
+	Alive             bool          `json:"alive"`
+	LastHeartbeat     *int64        `json:"last_heartbeat"`
+	ApplicationOnline bool          `json:"applicationOnline"`
+	Application       string        `json:"application,omitempty"`
+	Introduce         string        `json:"introduce,omitempty"`
+	RGBA              string        `json:"rgba,omitempty"`
+	Device            string        `json:"device,omitempty"`
+	Online            int           `json:"online"`
+	StaleAfter        int64         `json:"staleAfter"`
+	Devices           []lowerDevice `json:"devices"`
+}
+
+// newPresenceResponse 汇总所有设备的状态，devices 需按最近心跳时间倒序排列
+func newPresenceResponse(devices []models.Device, now time.Time, staleAfter time.Duration) presenceResponse {
+	response := presenceResponse{
+		StaleAfter: int64(staleAfter.Seconds()),
+		Devices:    make([]lowerDevice, len(devices)),
+	}
+	for i, device := range devices {
+		lower := newLowerDevice(device, now, staleAfter)
+		response.Devices[i] = lower
+		if lower.Alive {
+			response.Alive = true
+			response.Online++
+		}
+	}
+	if len(response.Devices) > 0 {
+		latest := response.Devices[0]
+		response.LastHeartbeat = &latest.LastHeartbeat
+		response.ApplicationOnline = latest.ApplicationOnline
+		response.Application = latest.Application
+		response.Introduce = latest.Introduce
+		response.RGBA = latest.RGBA
+		response.Device = latest.Device
+	}
+	return response
+}
+
+// listDevices 按最近心跳时间倒序返回所有设备
+func listDevices(ctx context.Context) ([]models.Device, error) {
+	cursor, err := models.DevicesCollection.Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "lastHeartbeat", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	devices := []models.Device{}
+	if err := cursor.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// parseOptionalBool 解析可选的布尔参数，为空时返回 nil
+func parseOptionalBool(name, value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return &b, nil
+}
+
+// Heartbeat 更新设备的在线状态，令牌由 heartbeat 权限范围校验
+//
+// device 为空时使用 default，兼容只有一台设备的旧客户端
+func Heartbeat(c *gin.Context) {
+	deviceID := c.PostForm("device")
+	if deviceID == "" {
+		deviceID = defaultDeviceID
+	}
+	if !deviceIDPattern.MatchString(deviceID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device: must be 1-64 letters, digits, '_', '.' or '-'"})
+		return
+	}
+
+	device := models.Device{
+		ID:                deviceID,
+		Application:       c.PostForm("application"),
+		Introduce:         c.PostForm("introduce"),
+		RGBA:              c.PostForm("rgba"),
+		ApplicationOnline: c.PostForm("applicationOnline") == "true",
+		LastHeartbeat:     time.Now(),
+	}
+	if value := c.PostForm("battery"); value != "" {
+		battery, err := strconv.Atoi(value)
+		if err != nil || battery < 0 || battery > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid battery: must be between 0 and 100"})
+			return
+		}
+		device.Battery = &battery
+	}
+	charging, err := parseOptionalBool("charging", c.PostForm("charging"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	device.Charging = charging
+
+	device, err = saveHeartbeat(c.Request.Context(), device)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Heartbeat received",
+		"device":            device.ID,
+		"application":       device.Application,
+		"introduce":         device.Introduce,
+		"rgba":              device.RGBA,
+		"applicationOnline": device.ApplicationOnline,
+		"battery":           device.Battery,
+		"charging":          device.Charging,
+	})
+}
+
+// Check 返回每台设备和汇总的在线状态
+func Check(c *gin.Context) {
+	devices, err := listDevices(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newPresenceResponse(devices, time.Now(), presenceStaleAfter()))
+}
+
+// CheckSVG 重定向到状态徽章，任意设备在线时显示 Alive
+func CheckSVG(c *gin.Context) {
+	devices, err := listDevices(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	alive := newPresenceResponse(devices, time.Now(), presenceStaleAfter()).Alive
+
+	// Base64 编码的脉冲动画图标
+	pulseIcon := "PHN2ZyB4bWxucz0iaHR0cDovL3d3dy53My5vcmcvMjAwMC9zdmciIHdpZHRoPSIxNiIgaGVpZ2h0PSIxNiIgdmlld0JveD0iMCAwIDE2IDE2Ij48Y2lyY2xlIGN4PSI4IiBjeT0iOCIgcj0iNCIgZmlsbD0iIzQ0YzQ3MCIgc3R5bGU9ImFuaW1hdGlvbjogcHVsc2UgMnMgaW5maW5pdGUiPjwvY2lyY2xlPjxzdHlsZT5Aa2V5ZnJhbWVzIHB1bHNlIHswJSB7b3BhY2l0eTogMX01MCUge29wYWNpdHk6IDAuNX0xMDAlIHtvcGFjaXR5OiAxfX08L3N0eWxlPjwvc3ZnPg=="
+
+	var redirectURL string
+	if alive {
+		redirectURL = fmt.Sprintf("https://img.shields.io/badge/Status-Alive-brightgreen?style=for-the-badge&logo=data:image/svg+xml;base64,%s", pulseIcon)
+	} else {
+		redirectURL = fmt.Sprintf("https://img.shields.io/badge/Status-Sleep-9f7be1?style=for-the-badge&logo=data:image/svg+xml;base64,%s", pulseIcon)
+	}
+
+	c.Redirect(http.StatusMovedPermanently, redirectURL)
+}
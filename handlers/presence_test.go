@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/models"
+)
+
+func newPresenceRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/heartbeat", Heartbeat)
+	r.GET("/check", Check)
+	r.GET("/check/history", CheckHistory)
+	r.GET("/check/timeline", CheckTimeline)
+	return r
+}
+
+// heartbeat 以表单提交一次心跳，返回状态码
+func heartbeat(t *testing.T, r *gin.Engine, fields map[string]string) int {
+	t.Helper()
+	form := url.Values{}
+	for name, value := range fields {
+		form.Set(name, value)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/heartbeat", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// ageDevice 把设备的最近心跳时间提前 d，模拟一段时间没有心跳
+func ageDevice(t *testing.T, device string, d time.Duration) {
+	t.Helper()
+	_, err := models.DevicesCollection.UpdateOne(context.Background(), bson.M{"_id": device},
+		bson.M{"$set": bson.M{"lastHeartbeat": time.Now().Add(-d)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeartbeatRejectsInvalidFields(t *testing.T) {
+	testutil.SetupDB(t)
+	r := newPresenceRouter()
+	for _, fields := range []map[string]string{
+		{"device": "../phone"},
+		{"device": strings.Repeat("a", 65)},
+		{"battery": "101"},
+		{"battery": "full"},
+		{"charging": "maybe"},
+	} {
+		if code := heartbeat(t, r, fields); code != http.StatusBadRequest {
+			t.Errorf("heartbeat %v: status %d, want 400", fields, code)
+		}
+	}
+	if n, _ := models.DevicesCollection.CountDocuments(context.Background(), bson.M{}); n != 0 {
+		t.Errorf("%d devices saved from invalid heartbeats", n)
+	}
+}
+
+func TestPresenceAcrossDevices(t *testing.T) {
+	testutil.SetupDB(t)
+	t.Setenv("PRESENCE_STALE_AFTER", "10m")
+	t.Setenv("PRESENCE_PRIVATE_APPS", "Secret")
+	r := newPresenceRouter()
+
+	check := func() presenceResponse {
+		t.Helper()
+		var resp presenceResponse
+		if code := requestJSON(t, r, http.MethodGet, "/check", nil, &resp); code != http.StatusOK {
+			t.Fatalf("check: status %d", code)
+		}
+		return resp
+	}
+
+	resp := check()
+	if resp.Alive || resp.LastHeartbeat != nil || len(resp.Devices) != 0 {
+		t.Errorf("check without devices: %+v", resp)
+	}
+
+	// 未指定 device 的旧客户端使用 default
+	if code := heartbeat(t, r, map[string]string{"application": "Editor", "applicationOnline": "true", "battery": "50", "charging": "true"}); code != http.StatusOK {
+		t.Fatalf("heartbeat: status %d", code)
+	}
+	if code := heartbeat(t, r, map[string]string{"device": "laptop", "application": "Browser", "applicationOnline": "false"}); code != http.StatusOK {
+		t.Fatalf("heartbeat: status %d", code)
+	}
+
+	resp = check()
+	if !resp.Alive || resp.Online != 2 || len(resp.Devices) != 2 || resp.StaleAfter != 600 {
+		t.Fatalf("check: %+v", resp)
+	}
+	// 顶层字段取自最近一次心跳的设备，应用不在前台时不展示
+	if resp.Device != "laptop" || resp.Application != "" || resp.Devices[1].Device != defaultDeviceID {
+		t.Errorf("latest device: %+v", resp)
+	}
+	phone := resp.Devices[1]
+	if phone.Application != "Editor" || phone.Battery == nil || *phone.Battery != 50 || phone.Charging == nil || !*phone.Charging {
+		t.Errorf("default device: %+v", phone)
+	}
+
+	// 本次没有上报电量时清除旧值，不公开的应用不展示
+	heartbeat(t, r, map[string]string{"application": "Secret", "applicationOnline": "true"})
+	resp = check()
+	phone = resp.Devices[0]
+	if phone.Device != defaultDeviceID || phone.Battery != nil || phone.Charging != nil || phone.Application != "" || !phone.ApplicationOnline {
+		t.Errorf("default device after second heartbeat: %+v", phone)
+	}
+
+	ageDevice(t, "laptop", 11*time.Minute)
+	resp = check()
+	if !resp.Alive || resp.Online != 1 || resp.Devices[1].Alive {
+		t.Errorf("check with a stale device: %+v", resp)
+	}
+	ageDevice(t, defaultDeviceID, 11*time.Minute)
+	if resp = check(); resp.Alive || resp.Online != 0 {
+		t.Errorf("check with all devices stale: %+v", resp)
+	}
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+	"pysio.online/blog_api/utils"
+)
+
+const (
+	defaultPresignUploadExpiry = 15 * time.Minute
+	defaultPresignGetExpiry    = time.Hour
+	defaultMaxPresignedSize    = 100 << 20
+	// S3 预签名地址的最长有效期
+	maxPresignExpiry = 7 * 24 * time.Hour
+	// uploadFinalizeGrace 上传地址过期后仍可完成上传的时间，与 uploads 集合的 TTL 索引保持一致
+	uploadFinalizeGrace = time.Hour
+)
+
+// presignExpiry 读取预签名地址有效期，限制在 S3 允许的范围内
+func presignExpiry(key string, fallback time.Duration) time.Duration {
+	d := utils.DurationFromEnv(key, fallback)
+	if d <= 0 || d > maxPresignExpiry {
+		return fallback
+	}
+	return d
+}
+
+// presignUploadExpiry 上传地址的有效期，可通过 PRESIGN_UPLOAD_EXPIRY 配置
+func presignUploadExpiry() time.Duration {
+	return presignExpiry("PRESIGN_UPLOAD_EXPIRY", defaultPresignUploadExpiry)
+}
+
+// presignGetExpiry 下载地址的有效期，可通过 PRESIGN_GET_EXPIRY 配置
+func presignGetExpiry() time.Duration {
+	return presignExpiry("PRESIGN_GET_EXPIRY", defaultPresignGetExpiry)
+}
+
+// maxPresignedUploadSize 预签名上传的文件大小上限，可通过 MAX_PRESIGNED_UPLOAD_SIZE 配置（支持 K/M/G 后缀）
+//
+// 文件不经过 API 上传，但 finalize 时仍需要整体读入内存解码和转码，上限应按 API 可用内存设置
+func maxPresignedUploadSize() int64 {
+	return utils.ByteSizeFromEnv("MAX_PRESIGNED_UPLOAD_SIZE", defaultMaxPresignedSize)
+}
+
+// minioStore 返回已注册的 S3 后端，未配置 Minio 时返回 false
+func minioStore() (*storage.MinioStore, bool) {
+	store, err := storage.Get(storage.BackendS3)
+	if err != nil {
+		return nil, false
+	}
+	minioStore, ok := store.(*storage.MinioStore)
+	return minioStore, ok
+}
+
+func newUploadTicketID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type createUploadRequest struct {
+	Filename      string   `json:"filename"`
+	Size          int64    `json:"size"`
+	Quality       string   `json:"quality"`
+	Lossless      string   `json:"lossless"`
+	StripMetadata string   `json:"strip_metadata"`
+	KeepExif      string   `json:"keep_exif"`
+	Animated      string   `json:"animated"`
+	Tags          []string `json:"tags"`
+	Title         string   `json:"title"`
+	Alt           string   `json:"alt"`
+}
+
+type uploadTicketResponse struct {
+	Ticket      string    `json:"ticket"`
+	UploadURL   string    `json:"uploadUrl"`
+	Method      string    `json:"method"`
+	FinalizeURL string    `json:"finalizeUrl"`
+	MaxSize     int64     `json:"maxSize"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// CreateUpload 创建预签名上传凭据
+//
+// 客户端用返回的地址把原始文件直接 PUT 到存储桶的暂存目录，再调用 finalize 完成校验、转码和入库
+func CreateUpload(c *gin.Context) {
+	var req createUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	store, ok := minioStore()
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Presigned uploads require Minio storage"})
+		return
+	}
+
+	maxSize := maxPresignedUploadSize()
+	if req.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("file too large: limit is %d bytes", maxSize)})
+		return
+	}
+
+	// 上传参数在创建凭据时校验，finalize 时按相同的参数处理
+	form := url.Values{
+		"quality":        {req.Quality},
+		"lossless":       {req.Lossless},
+		"strip_metadata": {req.StripMetadata},
+		"keep_exif":      {req.KeepExif},
+		"animated":       {req.Animated},
+		"tags":           req.Tags,
+		"title":          {req.Title},
+		"alt":            {req.Alt},
+	}
+	if _, err := parseUploadOptions(form); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	now := time.Now()
+	expiry := presignUploadExpiry()
+	ticket := models.UploadTicket{
+		ID:        newUploadTicketID(),
+		Filename:  req.Filename,
+		Options:   form,
+		CreatedAt: now,
+		ExpiresAt: now.Add(expiry),
+	}
+
+	uploadURL, err := store.PresignUpload(ctx, ticket.ID, expiry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to presign upload: %v", err)})
+		return
+	}
+	if _, err := models.UploadsCollection.InsertOne(ctx, ticket); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, uploadTicketResponse{
+		Ticket:      ticket.ID,
+		UploadURL:   uploadURL.String(),
+		Method:      http.MethodPut,
+		FinalizeURL: "/admin/images/uploads/" + ticket.ID + "/finalize",
+		MaxSize:     maxSize,
+		ExpiresAt:   ticket.ExpiresAt,
+	})
+}
+
+// FinalizeUpload 处理已上传到暂存目录的文件，流程与表单上传相同
+//
+// 文件尚未上传时返回 409，凭据保留以便重试；处理完成后凭据和暂存对象都会被删除
+func FinalizeUpload(c *gin.Context) {
+	id := c.Param("ticket")
+	ctx := c.Request.Context()
+
+	var ticket models.UploadTicket
+	err := models.UploadsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&ticket)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Upload ticket not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if time.Now().After(ticket.ExpiresAt.Add(uploadFinalizeGrace)) {
+		c.JSON(http.StatusGone, gin.H{"error": "Upload ticket expired"})
+		return
+	}
+
+	opts, err := parseUploadOptions(url.Values(ticket.Options))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	store, ok := minioStore()
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "Presigned uploads require Minio storage"})
+		return
+	}
+
+	file := uploadFile{Filename: ticket.Filename}
+	data, err := store.GetUpload(ctx, ticket.ID, maxPresignedUploadSize())
+	switch {
+	case err == storage.ErrNotFound:
+		c.JSON(http.StatusConflict, gin.H{"error": "File has not been uploaded yet"})
+		return
+	case err != nil:
+		file.Rejected = err.Error()
+	default:
+		file.Data = data
+	}
+
+	// 删除凭据作为占用标记，避免同一个凭据被并发处理两次
+	result, err := models.UploadsCollection.DeleteOne(ctx, bson.M{"_id": ticket.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload is already being finalized"})
+		return
+	}
+
+	uploaded := processUpload(context.Background(), file, opts)
+
+	if err := store.DeleteUpload(context.Background(), ticket.ID); err != nil {
+		log.Printf("Failed to delete staged upload %s: %v", ticket.ID, err)
+	}
+	respondUploadResults(c, []uploadResult{uploaded})
+}
+
+// StartUploadSweeper 在后台定期删除没有完成的暂存上传，未配置 Minio 时不启动
+func StartUploadSweeper() {
+	store, ok := minioStore()
+	if !ok {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(uploadFinalizeGrace)
+		defer ticker.Stop()
+		for {
+			// 暂存对象在上传地址和完成上传的时间都过期后才删除
+			before := time.Now().Add(-presignUploadExpiry() - uploadFinalizeGrace)
+			purged, err := store.PurgeUploads(context.Background(), before)
+			if err != nil {
+				log.Printf("Failed to purge staged uploads: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d abandoned uploads", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/models"
+)
+
+const maxRandomCount = 50
+
+// seedToRandKey 将任意字符串种子映射到 [0, 1) 区间
+func seedToRandKey(seed string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	return float64(h.Sum64()>>11) / float64(1<<53)
+}
+
+// sampleImages 使用 $sample 随机抽取图片，适用于除回收站外没有其他过滤条件的情况
+func sampleImages(ctx context.Context, filter bson.M, count int) ([]models.Image, error) {
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: filter}},
+		bson.D{{Key: "$sample", Value: bson.M{"size": count}}},
+		bson.D{{Key: "$project", Value: bson.M{"data": 0}}},
+	}
+
+	cursor, err := models.ImagesCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var images []models.Image
+	if err := cursor.All(ctx, &images); err != nil {
+		return nil, err
+	}
+
+	// $sample 可能返回重复文档
+	seen := make(map[string]bool)
+	unique := images[:0]
+	for _, image := range images {
+		if !seen[image.Hash] {
+			seen[image.Hash] = true
+			unique = append(unique, image)
+		}
+	}
+	return unique, nil
+}
+
+// pickImagesByRandKey 从随机键 key 开始按索引顺序取图，不足时从头回绕
+func pickImagesByRandKey(ctx context.Context, filter bson.M, key float64, count int) ([]models.Image, error) {
+	find := func(cond bson.M, limit int) ([]models.Image, error) {
+		merged := bson.M{"rand": cond}
+		for k, v := range filter {
+			merged[k] = v
+		}
+		opts := options.Find().
+			SetSort(bson.D{{Key: "rand", Value: 1}}).
+			SetLimit(int64(limit)).
+			SetProjection(bson.M{"data": 0})
+		cursor, err := models.ImagesCollection.Find(ctx, merged, opts)
+		if err != nil {
+			return nil, err
+		}
+		var images []models.Image
+		err = cursor.All(ctx, &images)
+		return images, err
+	}
+
+	images, err := find(bson.M{"$gte": key}, count)
+	if err != nil || len(images) >= count {
+		return images, err
+	}
+	wrapped, err := find(bson.M{"$lt": key}, count-len(images))
+	if err != nil {
+		return nil, err
+	}
+	return append(images, wrapped...), nil
+}
+
+// GetRandomImage 随机返回图片
+//
+// 支持 tag/orientation/min_width/min_height/animated 过滤，album 限定相册；seed 固定结果；
+// count=N 时以 JSON 返回 N 张不重复的图片
+func GetRandomImage(c *gin.Context) {
+	filter, err := buildImageFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 只从指定相册中随机
+	if slug := c.Query("album"); slug != "" {
+		hashes, err := albumFilter(c.Request.Context(), slug)
+		if err != nil {
+			respondAlbumError(c, err)
+			return
+		}
+		filter["hash"] = hashes
+	}
+
+	// 无过滤条件时 $sample 可以直接使用随机游标
+	useSample := len(filter) == 0
+
+	notDeleted(filter)
+
+	// 重定向模式下只有 Minio 中的图片可以通过公共地址访问
+	if imageServeMode() == serveModeRedirect {
+		filter["useS3"] = true
+	}
+
+	count := 1
+	countParam := c.Query("count")
+	if countParam != "" {
+		count, err = strconv.Atoi(countParam)
+		if err != nil || count < 1 || count > maxRandomCount {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid count: must be between 1 and %d", maxRandomCount)})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	var images []models.Image
+	if seed := c.Query("seed"); seed != "" {
+		images, err = pickImagesByRandKey(ctx, filter, seedToRandKey(seed), count)
+	} else if useSample {
+		images, err = sampleImages(ctx, filter, count)
+	} else {
+		images, err = pickImagesByRandKey(ctx, filter, rand.Float64(), count)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get random image: %v", err)})
+		return
+	}
+
+	if len(images) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No images available"})
+		return
+	}
+
+	if countParam == "" {
+		// 查到随机图片后重定向到图片地址
+		c.Redirect(http.StatusTemporaryRedirect, imageURL(images[0].Hash))
+		return
+	}
+
+	results := make([]gin.H, len(images))
+	for i, image := range images {
+		results[i] = gin.H{
+			"url":   imageURL(image.Hash),
+			"image": newLowerImage(image),
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"count":  len(results),
+		"images": results,
+	})
+}
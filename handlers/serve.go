@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/sync/singleflight"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+	"pysio.online/blog_api/utils"
+)
+
+const defaultImagePublicBaseURL = "https://minioapi.pysio.online/randomimg"
+
+// 图片访问方式：proxy 由 API 直接返回图片数据，redirect 重定向到公共地址，
+// presign 将保存在 Minio 中的图片重定向到限时的预签名地址
+const (
+	serveModeProxy    = "proxy"
+	serveModeRedirect = "redirect"
+	serveModePresign  = "presign"
+)
+
+func imageServeMode() string {
+	switch mode := os.Getenv("IMAGE_SERVE_MODE"); mode {
+	case serveModeRedirect, serveModePresign:
+		return mode
+	}
+	return serveModeProxy
+}
+
+// imagePublicURL 返回图片在公共存储上的地址
+func imagePublicURL(hash string) string {
+	base := os.Getenv("IMAGE_PUBLIC_BASE_URL")
+	if base == "" {
+		base = defaultImagePublicBaseURL
+	}
+	return fmt.Sprintf("%s/%s.webp", strings.TrimRight(base, "/"), hash)
+}
+
+// imageURL 返回客户端访问图片应使用的地址
+func imageURL(hash string) string {
+	if imageServeMode() == serveModeRedirect {
+		return imagePublicURL(hash)
+	}
+	return "/i/" + hash
+}
+
+// loadGroup 合并同一张图片（或同一变体）并发的缓存未命中，只读取或生成一次
+var loadGroup singleflight.Group
+
+// loadShared 通过 loadGroup 执行 fn，调用方取消请求不会影响其他等待的请求
+func loadShared(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	ctx = context.WithoutCancel(ctx)
+	v, err, _ := loadGroup.Do(key, func() (interface{}, error) {
+		return fn(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// loadImageData 优先从缓存读取图片数据，未命中时从存储后端读取并写入缓存
+func loadImageData(ctx context.Context, image *models.Image) ([]byte, error) {
+	if data, err := utils.LoadImageFromCache(image.Hash); err == nil && len(data) > 0 {
+		return data, nil
+	}
+
+	return loadShared(ctx, image.Hash, func(ctx context.Context) ([]byte, error) {
+		data := image.Data
+		if len(data) == 0 {
+			store, err := storage.ForImage(image)
+			if err != nil {
+				return nil, err
+			}
+			if data, err = store.Get(ctx, image.Hash); err != nil {
+				return nil, err
+			}
+		}
+
+		_ = utils.SaveImageToCache(image.Hash, data)
+		return data, nil
+	})
+}
+
+// etagMatches 判断 If-None-Match 请求头是否匹配给定的 ETag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// errVariantBusy 等待生成变体的时间过长，由调用方返回 503
+var errVariantBusy = errors.New("too many image transforms in progress, try again later")
+
+const variantQueueTimeout = 10 * time.Second
+
+var (
+	variantSlotsOnce sync.Once
+	variantSlots     chan struct{}
+)
+
+// acquireVariantSlot 占用一个变体生成名额，同时生成的数量由 TRANSFORM_CONCURRENCY 限制（默认为 CPU 核数）；
+// 缩放和编码会占满 CPU，超出的请求排队等待，等待超过 variantQueueTimeout 时返回 errVariantBusy
+func acquireVariantSlot(ctx context.Context) (func(), error) {
+	variantSlotsOnce.Do(func() {
+		n := runtime.NumCPU()
+		if value := os.Getenv("TRANSFORM_CONCURRENCY"); value != "" {
+			if v, err := strconv.Atoi(value); err == nil && v > 0 {
+				n = v
+			}
+		}
+		variantSlots = make(chan struct{}, n)
+	})
+
+	timer := time.NewTimer(variantQueueTimeout)
+	defer timer.Stop()
+	select {
+	case variantSlots <- struct{}{}:
+		return func() { <-variantSlots }, nil
+	case <-timer.C:
+		return nil, errVariantBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// loadImageVariant 返回缩放/转码后的图片，结果保存在磁盘缓存中
+func loadImageVariant(ctx context.Context, image *models.Image, opts utils.TransformOptions) ([]byte, error) {
+	key := opts.CacheKey(image.Hash)
+	if data, err := utils.LoadVariantFromCache(key); err == nil && len(data) > 0 {
+		return data, nil
+	}
+
+	return loadShared(ctx, key, func(ctx context.Context) ([]byte, error) {
+		release, err := acquireVariantSlot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		original, err := loadImageData(ctx, image)
+		if err != nil {
+			return nil, err
+		}
+		data, err := utils.TransformImage(original, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		_ = utils.SaveVariantToCache(key, data)
+		return data, nil
+	})
+}
+
+// imageCacheControl 返回图片响应的 Cache-Control
+//
+// 地址中的 hash 是原始数据的 MD5，内容不会变化，可以长期缓存；重新编码过的图片在同一地址下已经换过一次内容，
+// 只缓存一天，之后通过 ETag 重新验证
+func imageCacheControl(image *models.Image) string {
+	if image.Checksum != "" {
+		return "public, max-age=86400"
+	}
+	return "public, max-age=31536000, immutable"
+}
+
+// serveImage 返回图片数据，支持 ETag/Last-Modified 条件请求
+//
+// 支持 width/height/fit/quality/format 查询参数按需生成缩略图，未指定 format 时根据 Accept 协商
+func serveImage(c *gin.Context, hash string) {
+	opts, err := utils.ParseTransformOptions(c.Query("width"), c.Query("height"), c.Query("fit"), c.Query("quality"), c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	transform := !opts.IsZero()
+
+	ctx := c.Request.Context()
+
+	var image models.Image
+	err = models.ImagesCollection.FindOne(ctx, notDeleted(bson.M{"hash": hash}),
+		options.FindOne().SetProjection(bson.M{"data": 0})).Decode(&image)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 动图不支持缩放和转码，直接返回原图
+	if image.Animated {
+		transform = false
+	}
+	// 不放大图片，超出原图的尺寸与原图尺寸共用同一个变体
+	opts = opts.ClampTo(image.Width, image.Height)
+
+	// 重新编码过的图片内容已变化，使用新的校验和作为 ETag
+	version := image.Hash
+	if image.Checksum != "" {
+		version = image.Checksum
+	}
+	etag := `"` + version + `"`
+	if transform {
+		if opts.Format == "" {
+			opts.Format = utils.NegotiateFormat(c.GetHeader("Accept"))
+			c.Header("Vary", "Accept")
+		}
+		// 只协商出 WebP 且不缩放时直接返回原图
+		if opts.Format == utils.FormatWebP && opts.Width == 0 && opts.Height == 0 && opts.Quality == 0 {
+			transform = false
+		} else {
+			etag = `"` + opts.CacheKey(version) + `"`
+		}
+	}
+	lastModified := image.CreatedAt.UTC().Truncate(time.Second)
+
+	// 公共存储无法生成变体，只有访问原图时才重定向；只有 Minio 中的图片存在公共地址，其他后端仍由 API 返回数据
+	if imageServeMode() == serveModeRedirect && !transform && image.Backend() == storage.BackendS3 {
+		c.Redirect(http.StatusFound, imagePublicURL(image.Hash))
+		return
+	}
+
+	// 预签名地址会过期，重定向响应只能在有效期内缓存
+	if imageServeMode() == serveModePresign && !transform && image.Backend() == storage.BackendS3 {
+		if store, ok := minioStore(); ok {
+			expiry := presignGetExpiry()
+			u, err := store.PresignGet(ctx, image.Hash, expiry)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to presign image: %v", err)})
+				return
+			}
+			c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(expiry.Seconds()/2)))
+			c.Redirect(http.StatusFound, u.String())
+			return
+		}
+	}
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", imageCacheControl(&image))
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+
+	// 图片内容由 hash 唯一确定，条件请求命中时直接返回 304
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		if etagMatches(inm, etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	} else if ims := c.GetHeader("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !lastModified.After(t) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	var data []byte
+	contentType := image.ContentType
+	if transform {
+		data, err = loadImageVariant(ctx, &image, opts)
+		contentType = utils.ContentTypeForFormat(opts.Format)
+	} else {
+		data, err = loadImageData(ctx, &image)
+	}
+	if err != nil {
+		if err == storage.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image data not found"})
+			return
+		}
+		if err == errVariantBusy {
+			c.Header("Retry-After", "5")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load image: %v", err)})
+		return
+	}
+
+	if contentType == "" {
+		contentType = "image/webp"
+	}
+	c.Header("Content-Length", strconv.Itoa(len(data)))
+	if c.Request.Method == http.MethodHead {
+		c.Header("Content-Type", contentType)
+		c.Status(http.StatusOK)
+		return
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
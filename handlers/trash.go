@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+	"pysio.online/blog_api/utils"
+)
+
+const (
+	defaultTrashRetention     = 30 * 24 * time.Hour
+	defaultTrashPurgeInterval = time.Hour
+)
+
+// trashRetention 回收站中的图片保留多久后永久删除，可通过 TRASH_RETENTION 配置（如 "30d"、"72h"）
+func trashRetention() time.Duration {
+	return utils.DurationFromEnv("TRASH_RETENTION", defaultTrashRetention)
+}
+
+// purgeImage 永久删除匹配 filter 的图片：数据库记录、存储后端中的数据、缓存和相册引用
+//
+// 先通过 FindOneAndDelete 认领记录，记录已不满足 filter（例如已被恢复）时不会删除任何数据，返回 false
+func purgeImage(ctx context.Context, filter bson.M) (bool, error) {
+	var image models.Image
+	err := models.ImagesCollection.FindOneAndDelete(ctx, filter,
+		options.FindOneAndDelete().SetProjection(bson.M{"data": 0})).Decode(&image)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	utils.DeleteImageFromCache(image.Hash)
+	if err := removeImageFromAlbums(ctx, image.Hash); err != nil {
+		return true, err
+	}
+
+	store, err := storage.ForImage(&image)
+	if err != nil {
+		return true, err
+	}
+	if err := store.Delete(ctx, image.Hash); err != nil && err != storage.ErrNotFound {
+		return true, fmt.Errorf("failed to delete image from %s storage: %v", store.Name(), err)
+	}
+	return true, nil
+}
+
+// purgeExpiredImages 永久删除超过保留期限的图片，返回删除数量
+func purgeExpiredImages(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-trashRetention())
+	cursor, err := models.ImagesCollection.Find(ctx, bson.M{"deletedAt": bson.M{"$lte": cutoff}},
+		options.Find().SetProjection(bson.M{"hash": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var images []models.Image
+	if err := cursor.All(ctx, &images); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, image := range images {
+		// 查询之后图片可能已被恢复，删除时需要再次检查删除时间
+		ok, err := purgeImage(ctx, bson.M{"hash": image.Hash, "deletedAt": bson.M{"$lte": cutoff}})
+		if err != nil {
+			log.Printf("Failed to purge image %s: %v", image.Hash, err)
+		}
+		if ok {
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// StartTrashPurger 在后台定期清理回收站，间隔可通过 TRASH_PURGE_INTERVAL 配置
+func StartTrashPurger() {
+	interval := utils.DurationFromEnv("TRASH_PURGE_INTERVAL", defaultTrashPurgeInterval)
+	if interval <= 0 {
+		log.Printf("Trash purge disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			purged, err := purgeExpiredImages(context.Background())
+			if err != nil {
+				log.Printf("Failed to purge trash: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d images from trash", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// ListTrash 列出回收站中的图片，按删除时间倒序
+func ListTrash(c *gin.Context) {
+	limit := maxListLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid limit: must be between 1 and %d", maxListLimit)})
+			return
+		}
+		limit = n
+	}
+
+	ctx := c.Request.Context()
+	filter := bson.M{"deletedAt": bson.M{"$exists": true}}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "deletedAt", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"data": 0})
+	cursor, err := models.ImagesCollection.Find(ctx, filter, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var images []models.Image
+	if err := cursor.All(ctx, &images); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	total, err := models.ImagesCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	retention := trashRetention()
+	results := make([]gin.H, len(images))
+	for i, image := range images {
+		results[i] = gin.H{
+			"image":   newLowerImage(image),
+			"purgeAt": image.DeletedAt.Add(retention),
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"images":    results,
+		"total":     total,
+		"retention": retention.String(),
+	})
+}
+
+// RestoreImage 将图片移出回收站
+func RestoreImage(c *gin.Context) {
+	hash := c.Param("hash")
+	result, err := models.ImagesCollection.UpdateOne(c.Request.Context(),
+		bson.M{"hash": hash, "deletedAt": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"deletedAt": ""}})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found in trash"})
+		return
+	}
+
+	image, err := findImageMeta(c.Request.Context(), hash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Image restored",
+		"image":   newLowerImage(image),
+	})
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+)
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	testutil.SetupDB(t)
+	store := testutil.SetupStorage(t, storage.BackendMem)
+	t.Setenv("TRASH_RETENTION", "7d")
+	ctx := context.Background()
+
+	r := newImageRouter()
+	r.GET("/admin/images/trash", ListTrash)
+	r.POST("/admin/images/:hash/restore", RestoreImage)
+	r.POST("/admin/albums", CreateAlbum)
+
+	var hashes []string
+	for seed := uint8(1); seed <= 2; seed++ {
+		_, results := upload(t, r, "image.png", testPNG(t, 20, 20, seed), nil)
+		if len(results) != 1 || results[0].Status != uploadCreated {
+			t.Fatalf("upload failed: %+v", results)
+		}
+		hashes = append(hashes, results[0].Hash)
+	}
+	expired, recent := hashes[0], hashes[1]
+	if code := requestJSON(t, r, http.MethodPost, "/admin/albums", gin.H{"slug": "trash", "images": hashes, "cover": expired}, nil); code != http.StatusCreated {
+		t.Fatalf("create album: status %d", code)
+	}
+
+	for _, hash := range hashes {
+		if rec := serve(r, http.MethodDelete, "/images/"+hash); rec.Code != http.StatusOK {
+			t.Fatalf("delete %s: status %d", hash, rec.Code)
+		}
+	}
+	if rec := serve(r, http.MethodDelete, "/images/"+recent); rec.Code != http.StatusNotFound {
+		t.Errorf("delete trashed image again: status %d, want 404", rec.Code)
+	}
+
+	var trash struct {
+		Images []struct {
+			Image   struct{ Hash string } `json:"image"`
+			PurgeAt time.Time             `json:"purgeAt"`
+		} `json:"images"`
+		Total     int    `json:"total"`
+		Retention string `json:"retention"`
+	}
+	if code := requestJSON(t, r, http.MethodGet, "/admin/images/trash", nil, &trash); code != http.StatusOK || trash.Total != 2 {
+		t.Fatalf("list trash: %d %+v", code, trash)
+	}
+	if trash.Retention != (7*24*time.Hour).String() || time.Until(trash.Images[0].PurgeAt) < 6*24*time.Hour {
+		t.Errorf("trash retention = %s, purgeAt = %s", trash.Retention, trash.Images[0].PurgeAt)
+	}
+
+	// 恢复后可以正常访问，再次恢复时不在回收站中
+	if code := requestJSON(t, r, http.MethodPost, "/admin/images/"+recent+"/restore", nil, nil); code != http.StatusOK {
+		t.Fatalf("restore: status %d", code)
+	}
+	if rec := serve(r, http.MethodGet, "/i/"+recent); rec.Code != http.StatusOK {
+		t.Errorf("serve restored image: status %d", rec.Code)
+	}
+	if code := requestJSON(t, r, http.MethodPost, "/admin/images/"+recent+"/restore", nil, nil); code != http.StatusNotFound {
+		t.Errorf("restore image not in trash: status %d, want 404", code)
+	}
+
+	// 超过保留期限的图片被永久删除，包括存储对象和相册引用
+	_, err := models.ImagesCollection.UpdateOne(ctx, bson.M{"hash": expired},
+		bson.M{"$set": bson.M{"deletedAt": time.Now().Add(-8 * 24 * time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	purged, err := purgeExpiredImages(ctx)
+	if err != nil || purged != 1 {
+		t.Fatalf("purgeExpiredImages = %d, %v; want 1", purged, err)
+	}
+	if n, _ := models.ImagesCollection.CountDocuments(ctx, bson.M{"hash": expired}); n != 0 {
+		t.Errorf("expired record still exists")
+	}
+	if _, err := store.Get(ctx, expired); err != storage.ErrNotFound {
+		t.Errorf("expired object: err = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Get(ctx, recent); err != nil {
+		t.Errorf("restored object removed: %v", err)
+	}
+	album, err := findAlbum(ctx, "trash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(album.Images) != 1 || album.Images[0] != recent || album.Cover != "" {
+		t.Errorf("album after purge: images %v, cover %q", album.Images, album.Cover)
+	}
+}
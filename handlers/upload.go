@@ -0,0 +1,517 @@
+package handlers
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+	"pysio.online/blog_api/utils"
+)
+
+const (
+	defaultMaxUploadSize  = 20 << 20
+	defaultMaxUploadFiles = 10
+	// 4000 万像素，解码为 RGBA 约占 160MB 内存
+	defaultMaxUploadPixels = 40_000_000
+	// 非文件表单字段的最大长度
+	maxFormValueSize = 64 << 10
+)
+
+// 单个文件的处理结果
+const (
+	uploadCreated   = "created"
+	uploadDuplicate = "duplicate"
+	uploadRejected  = "rejected"
+	uploadFailed    = "failed"
+)
+
+// 可以通过 keep_exif 保存到图片记录中的 EXIF 字段
+const (
+	exifCaptureDate = "capture_date"
+	exifCopyright   = "copyright"
+)
+
+// 动图的保存方式
+const (
+	animatedWebP     = "webp"
+	animatedOriginal = "original"
+)
+
+// uploadOptions 同一请求中所有图片共用的参数
+type uploadOptions struct {
+	WebP     utils.WebPOptions
+	Animated string
+	Tags     []string
+	Title    string
+	Alt      string
+	KeepExif map[string]bool
+}
+
+type uploadResult struct {
+	Filename  string         `json:"filename"`
+	SourceURL string         `json:"sourceUrl,omitempty"`
+	Status    string         `json:"status"`
+	Reason    string         `json:"reason,omitempty"`
+	Hash      string         `json:"hash,omitempty"`
+	Size      int            `json:"size,omitempty"`
+	Image     *lowerImage    `json:"image,omitempty"`
+	Warning   string         `json:"warning,omitempty"`
+	Similar   []similarImage `json:"similar,omitempty"`
+}
+
+// uploadFile 已读取的上传文件，超出限制的文件只记录拒绝原因
+type uploadFile struct {
+	Filename  string
+	SourceURL string
+	Data      []byte
+	Rejected  string
+}
+
+// maxUploadSize 单个文件的大小上限，可通过 MAX_UPLOAD_SIZE 配置（支持 K/M/G 后缀）
+func maxUploadSize() int64 {
+	return utils.ByteSizeFromEnv("MAX_UPLOAD_SIZE", defaultMaxUploadSize)
+}
+
+// maxUploadFiles 单个请求最多包含的文件数，可通过 MAX_UPLOAD_FILES 配置
+func maxUploadFiles() int {
+	if value := os.Getenv("MAX_UPLOAD_FILES"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultMaxUploadFiles
+}
+
+// maxUploadPixels 单张图片的像素数（宽×高）上限，可通过 MAX_UPLOAD_PIXELS 配置
+func maxUploadPixels() int64 {
+	if value := os.Getenv("MAX_UPLOAD_PIXELS"); value != "" {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultMaxUploadPixels
+}
+
+// readUploadForm 以流的方式读取 multipart 请求
+//
+// 每个文件最多读取 maxSize+1 字节，超出的部分直接丢弃，不会整体缓冲到内存或临时文件
+func readUploadForm(c *gin.Context) ([]uploadFile, url.Values, int, error) {
+	maxSize := maxUploadSize()
+	maxFiles := maxUploadFiles()
+	// 请求体总大小同样需要限制，额外预留表单字段的空间
+	maxBody := maxSize*int64(maxFiles) + 1<<20
+
+	if c.Request.ContentLength > maxBody {
+		return nil, nil, http.StatusRequestEntityTooLarge, fmt.Errorf("request body too large: limit is %d bytes", maxBody)
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, fmt.Errorf("invalid multipart request: %v", err)
+	}
+
+	var files []uploadFile
+	form := url.Values{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return nil, nil, http.StatusRequestEntityTooLarge, fmt.Errorf("request body too large: limit is %d bytes", maxBody)
+			}
+			return nil, nil, http.StatusBadRequest, fmt.Errorf("invalid multipart request: %v", err)
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormValueSize))
+			part.Close()
+			if err != nil {
+				return nil, nil, http.StatusBadRequest, fmt.Errorf("invalid multipart request: %v", err)
+			}
+			form.Add(part.FormName(), string(value))
+			continue
+		}
+
+		if part.FormName() != "image" {
+			part.Close()
+			continue
+		}
+
+		file := uploadFile{Filename: part.FileName()}
+		if len(files) >= maxFiles {
+			file.Rejected = fmt.Sprintf("too many files: limit is %d per request", maxFiles)
+			part.Close()
+			files = append(files, file)
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxSize+1))
+		if err != nil {
+			part.Close()
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return nil, nil, http.StatusRequestEntityTooLarge, fmt.Errorf("request body too large: limit is %d bytes", maxBody)
+			}
+			return nil, nil, http.StatusBadRequest, fmt.Errorf("failed to read %s: %v", file.Filename, err)
+		}
+		if int64(len(data)) > maxSize {
+			file.Rejected = fmt.Sprintf("file too large: limit is %d bytes", maxSize)
+		} else {
+			file.Data = data
+		}
+		part.Close()
+		files = append(files, file)
+	}
+
+	return files, form, http.StatusOK, nil
+}
+
+// parseKeepExif 解析需要保留的 EXIF 字段，未指定时使用 EXIF_KEEP_FIELDS 环境变量
+func parseKeepExif(value string) (map[string]bool, error) {
+	if value == "" {
+		value = os.Getenv("EXIF_KEEP_FIELDS")
+	}
+	keep := make(map[string]bool)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		switch field {
+		case "", "none":
+		case exifCaptureDate, exifCopyright:
+			keep[field] = true
+		default:
+			return nil, fmt.Errorf("invalid keep_exif: %s", field)
+		}
+	}
+	return keep, nil
+}
+
+// parseAnimatedMode 解析动图保存方式，未指定时使用 ANIMATED_FORMAT 环境变量，默认转换为 WebP 动图
+func parseAnimatedMode(value string) (string, error) {
+	if value == "" {
+		value = os.Getenv("ANIMATED_FORMAT")
+	}
+	switch value {
+	case "", animatedWebP:
+		return animatedWebP, nil
+	case animatedOriginal:
+		return animatedOriginal, nil
+	default:
+		return "", fmt.Errorf("invalid animated: %s", value)
+	}
+}
+
+func parseUploadOptions(form url.Values) (uploadOptions, error) {
+	webpOpts, err := utils.ParseWebPOptions(form.Get("quality"), form.Get("lossless"), form.Get("strip_metadata"))
+	if err != nil {
+		return uploadOptions{}, err
+	}
+	keepExif, err := parseKeepExif(form.Get("keep_exif"))
+	if err != nil {
+		return uploadOptions{}, err
+	}
+	animated, err := parseAnimatedMode(form.Get("animated"))
+	if err != nil {
+		return uploadOptions{}, err
+	}
+	return uploadOptions{
+		WebP:     webpOpts,
+		Animated: animated,
+		Tags:     normalizeTags(form["tags"]),
+		Title:    form.Get("title"),
+		Alt:      form.Get("alt"),
+		KeepExif: keepExif,
+	}, nil
+}
+
+// processUpload 校验、转码并保存一张图片
+func processUpload(ctx context.Context, file uploadFile, opts uploadOptions) uploadResult {
+	result := uploadResult{Filename: file.Filename, SourceURL: file.SourceURL}
+	reject := func(status, reason string) uploadResult {
+		result.Status = status
+		result.Reason = reason
+		return result
+	}
+	if file.Rejected != "" {
+		return reject(uploadRejected, file.Rejected)
+	}
+	buffer := file.Data
+
+	// 验证图片
+	if err := utils.ValidateImage(buffer); err != nil {
+		return reject(uploadRejected, fmt.Sprintf("Invalid image: %v", err))
+	}
+	// 后续的分析和转码都会完整解码图片，先按头部声明的尺寸拒绝超大图片
+	if err := utils.CheckImagePixels(buffer, maxUploadPixels()); err != nil {
+		return reject(uploadRejected, err.Error())
+	}
+
+	// 提取尺寸、主色调等信息
+	info, err := utils.AnalyzeImage(buffer)
+	if err != nil {
+		return reject(uploadRejected, fmt.Sprintf("Invalid image: %v", err))
+	}
+
+	// 转换为WebP并计算哈希，动图按 animated 参数转换为 WebP 动图或保留原图
+	var webpBuffer []byte
+	contentType := "image/webp"
+	animation, animated := utils.DetectAnimation(buffer)
+	switch {
+	case animated && opts.Animated == animatedOriginal:
+		webpBuffer = buffer
+		if info.Format == "gif" {
+			contentType = "image/gif"
+		} else {
+			webpBuffer = utils.StripWebPMetadata(buffer, false)
+		}
+	case animated:
+		webpBuffer, err = utils.EncodeAnimatedWebP(buffer)
+	default:
+		webpBuffer, err = utils.ConvertToWebpWithOptions(buffer, opts.WebP)
+	}
+	if err != nil {
+		return reject(uploadFailed, fmt.Sprintf("Failed to convert image to WebP: %v", err))
+	}
+
+	hash := fmt.Sprintf("%x", md5.Sum(webpBuffer))
+	result.Hash = hash
+
+	// 检查是否已存在（包括回收站中的图片）
+	var existing models.Image
+	err = models.ImagesCollection.FindOne(ctx, bson.M{"hash": hash},
+		options.FindOne().SetProjection(bson.M{"deletedAt": 1})).Decode(&existing)
+	if err == nil {
+		if existing.DeletedAt != nil {
+			return reject(uploadDuplicate, "Image already exists in trash, restore it instead")
+		}
+		return reject(uploadDuplicate, "Image already exists")
+	}
+	if err != mongo.ErrNoDocuments {
+		return reject(uploadFailed, err.Error())
+	}
+
+	store := storage.Default()
+
+	// 保存图片信息到数据库，图片数据由存储后端负责
+	image := models.Image{
+		Hash:           hash,
+		ContentType:    contentType,
+		CreatedAt:      time.Now(),
+		UseS3:          store.Name() == storage.BackendS3,
+		Storage:        store.Name(),
+		Width:          info.Width,
+		Height:         info.Height,
+		Size:           int64(len(webpBuffer)),
+		OriginalFormat: info.Format,
+		OriginalName:   file.Filename,
+		SourceURL:      file.SourceURL,
+		DominantColor:  info.DominantColor,
+		BlurHash:       info.BlurHash,
+		PHash:          info.PHash,
+		Animated:       animated,
+		FrameCount:     animation.Frames,
+		Duration:       animation.Duration,
+		Rand:           rand.Float64(),
+		Tags:           opts.Tags,
+		Title:          opts.Title,
+		Alt:            opts.Alt,
+	}
+
+	// 转码后的图片不含 EXIF，只在记录中保留白名单字段
+	if len(opts.KeepExif) > 0 {
+		exif := utils.ReadExif(buffer)
+		if opts.KeepExif[exifCaptureDate] && !exif.CaptureDate.IsZero() {
+			image.CapturedAt = &exif.CaptureDate
+		}
+		if opts.KeepExif[exifCopyright] {
+			image.Copyright = exif.Copyright
+		}
+	}
+
+	// 先插入记录占用 hash，唯一索引保证同时进行的相同上传只有一个会成功；
+	// MongoDB 存储把数据写入这条记录，因此必须先有记录再写数据
+	if _, err := models.ImagesCollection.InsertOne(ctx, image); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return reject(uploadDuplicate, "Image already exists")
+		}
+		return reject(uploadFailed, err.Error())
+	}
+	if err := store.Put(ctx, hash, webpBuffer, contentType); err != nil {
+		// 记录由本次上传创建，写入失败时连同可能写入一半的对象一起清理
+		_ = store.Delete(ctx, hash)
+		_, _ = models.ImagesCollection.DeleteOne(ctx, bson.M{"hash": hash})
+		return reject(uploadFailed, fmt.Sprintf("Failed to save image to %s storage: %v", store.Name(), err))
+	}
+
+	lower := newLowerImage(image)
+	result.Status = uploadCreated
+	result.Size = len(webpBuffer)
+	result.Image = &lower
+
+	// 相似图片只给出提示，不阻止上传
+	if image.PHash != "" {
+		similar, err := findSimilarImages(ctx, image.PHash, hash, duplicateThreshold())
+		if err == nil && len(similar) > 0 {
+			result.Warning = fmt.Sprintf("Found %d similar image(s)", len(similar))
+			result.Similar = similar
+		}
+		addToPHashIndex(hash, image.PHash)
+	}
+
+	return result
+}
+
+// respondUploadResults 汇总每个文件的处理结果
+//
+// 有图片保存成功时返回 201；全部重复时返回 409；否则按失败原因返回 500 或 400
+func respondUploadResults(c *gin.Context, results []uploadResult) {
+	summary := map[string]int{
+		uploadCreated:   0,
+		uploadDuplicate: 0,
+		uploadRejected:  0,
+		uploadFailed:    0,
+	}
+	for _, result := range results {
+		summary[result.Status]++
+	}
+
+	status := http.StatusBadRequest
+	switch {
+	case summary[uploadCreated] > 0:
+		status = http.StatusCreated
+	case summary[uploadDuplicate] == len(results):
+		status = http.StatusConflict
+	case summary[uploadFailed] > 0:
+		status = http.StatusInternalServerError
+	}
+
+	c.JSON(status, gin.H{
+		"results": results,
+		"summary": summary,
+	})
+}
+
+// AddImage 上传图片，一个请求中可以包含多个 image 文件
+func AddImage(c *gin.Context) {
+	files, form, status, err := readUploadForm(c)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Image file is required"})
+		return
+	}
+
+	// 编码参数可以按请求指定
+	opts, err := parseUploadOptions(form)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results := make([]uploadResult, len(files))
+	for i, file := range files {
+		results[i] = processUpload(context.Background(), file, opts)
+	}
+
+	respondUploadResults(c, results)
+}
+
+type addImageByURLRequest struct {
+	URL           string   `json:"url"`
+	URLs          []string `json:"urls"`
+	Quality       string   `json:"quality"`
+	Lossless      string   `json:"lossless"`
+	StripMetadata string   `json:"strip_metadata"`
+	KeepExif      string   `json:"keep_exif"`
+	Animated      string   `json:"animated"`
+	Tags          []string `json:"tags"`
+	Title         string   `json:"title"`
+	Alt           string   `json:"alt"`
+}
+
+// remoteFilename 使用地址路径的最后一段作为原始文件名
+func remoteFilename(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return u.Host
+	}
+	return name
+}
+
+// AddImageByURL 从远程地址下载图片并保存，支持一次提交多个地址
+func AddImageByURL(c *gin.Context) {
+	var req addImageByURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	urls := req.URLs
+	if req.URL != "" {
+		urls = append([]string{req.URL}, urls...)
+	}
+	if len(urls) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url or urls is required"})
+		return
+	}
+	if maxFiles := maxUploadFiles(); len(urls) > maxFiles {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("too many urls: limit is %d per request", maxFiles)})
+		return
+	}
+
+	form := url.Values{
+		"quality":        {req.Quality},
+		"lossless":       {req.Lossless},
+		"strip_metadata": {req.StripMetadata},
+		"keep_exif":      {req.KeepExif},
+		"animated":       {req.Animated},
+		"tags":           req.Tags,
+		"title":          {req.Title},
+		"alt":            {req.Alt},
+	}
+	opts, err := parseUploadOptions(form)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	maxSize := maxUploadSize()
+	results := make([]uploadResult, len(urls))
+	for i, rawURL := range urls {
+		file := uploadFile{Filename: remoteFilename(rawURL), SourceURL: rawURL}
+		data, err := utils.FetchRemoteImage(c.Request.Context(), rawURL, maxSize)
+		if err != nil {
+			file.Rejected = err.Error()
+		} else {
+			file.Data = data
+		}
+		results[i] = processUpload(context.Background(), file, opts)
+	}
+
+	respondUploadResults(c, results)
+}
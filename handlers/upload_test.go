@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+)
+
+// newImageRouter 注册上传、访问和删除接口，不经过认证中间件
+func newImageRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/images/add", AddImage)
+	r.GET("/i/:hash", GetImageByHash)
+	r.HEAD("/i/:hash", GetImageByHash)
+	r.DELETE("/images/:hash", DeleteImage)
+	return r
+}
+
+// testPNG 生成内容由 seed 决定的渐变图片
+func testPNG(t *testing.T, width, height int, seed uint8) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{uint8(x) + seed, uint8(y) * seed, uint8(x * y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// upload 以表单上传一个文件，返回响应和解析后的结果
+func upload(t *testing.T, r *gin.Engine, filename string, data []byte, fields map[string]string) (*httptest.ResponseRecorder, []uploadResult) {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for name, value := range fields {
+		_ = w.WriteField(name, value)
+	}
+	part, err := w.CreateFormFile("image", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(data)
+	_ = w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/images/add", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	var resp struct {
+		Results []uploadResult `json:"results"`
+	}
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp.Results
+}
+
+func serve(r *gin.Engine, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestUploadServeDeleteWithMemoryStore(t *testing.T) {
+	testUploadServeDelete(t, storage.BackendMem)
+}
+
+// MongoDB 存储把数据写入图片记录，需要覆盖记录和数据的写入顺序
+func TestUploadServeDeleteWithMongoStore(t *testing.T) {
+	testUploadServeDelete(t, storage.BackendMongo)
+}
+
+func testUploadServeDelete(t *testing.T, backend string) {
+	testutil.SetupDB(t)
+	store := testutil.SetupStorage(t, backend)
+	r := newImageRouter()
+	ctx := context.Background()
+
+	rec, results := upload(t, r, "gradient.png", testPNG(t, 64, 48, 1), map[string]string{"tags": "test"})
+	if rec.Code != http.StatusCreated || len(results) != 1 || results[0].Status != uploadCreated {
+		t.Fatalf("upload: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	hash := results[0].Hash
+	if img := results[0].Image; img == nil || img.Storage != backend || img.Width != 64 || img.Height != 48 {
+		t.Fatalf("unexpected image record: %+v", results[0].Image)
+	}
+	stored, err := store.Get(ctx, hash)
+	if err != nil {
+		t.Fatalf("image not written to %s store: %v", backend, err)
+	}
+
+	// 相同的文件再次上传时报告重复
+	rec, results = upload(t, r, "gradient.png", testPNG(t, 64, 48, 1), nil)
+	if rec.Code != http.StatusConflict || results[0].Status != uploadDuplicate {
+		t.Fatalf("duplicate upload: status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(r, http.MethodGet, "/i/"+hash)
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), stored) {
+		t.Fatalf("serve: status %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "image/webp" {
+		t.Errorf("Content-Type = %q, want image/webp", ct)
+	}
+	etag := rec.Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, "/i/"+hash, nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional request: status %d, want 304", rec.Code)
+	}
+
+	// 移入回收站后无法访问，数据仍保留
+	if rec = serve(r, http.MethodDelete, "/images/"+hash); rec.Code != http.StatusOK {
+		t.Fatalf("delete: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	if rec = serve(r, http.MethodGet, "/i/"+hash); rec.Code != http.StatusNotFound {
+		t.Errorf("serve trashed image: status %d, want 404", rec.Code)
+	}
+	if _, err := store.Get(ctx, hash); err != nil {
+		t.Errorf("trashed image data removed: %v", err)
+	}
+
+	// 永久删除同时清除记录和存储后端中的数据
+	if rec = serve(r, http.MethodDelete, "/images/"+hash+"?permanent=true"); rec.Code != http.StatusOK {
+		t.Fatalf("permanent delete: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	if _, err := store.Get(ctx, hash); err != storage.ErrNotFound {
+		t.Errorf("store.Get after permanent delete: err = %v, want ErrNotFound", err)
+	}
+	if n, _ := models.ImagesCollection.CountDocuments(ctx, bson.M{"hash": hash}); n != 0 {
+		t.Errorf("%d image records left after permanent delete", n)
+	}
+	if rec = serve(r, http.MethodDelete, "/images/"+hash); rec.Code != http.StatusNotFound {
+		t.Errorf("delete missing image: status %d, want 404", rec.Code)
+	}
+}
+
+func TestUploadRejectsInvalidFiles(t *testing.T) {
+	testutil.SetupDB(t)
+	testutil.SetupStorage(t, storage.BackendMem)
+	r := newImageRouter()
+
+	rec, results := upload(t, r, "notes.txt", []byte("not an image"), nil)
+	if rec.Code != http.StatusBadRequest || len(results) != 1 || results[0].Status != uploadRejected {
+		t.Fatalf("invalid file: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	if n, _ := models.ImagesCollection.CountDocuments(context.Background(), bson.M{}); n != 0 {
+		t.Errorf("%d image records created for a rejected upload", n)
+	}
+}
+
+func TestConcurrentIdenticalUploads(t *testing.T) {
+	testutil.SetupDB(t)
+	testutil.SetupStorage(t, storage.BackendMongo)
+	r := newImageRouter()
+	data := testPNG(t, 32, 32, 7)
+
+	const n = 4
+	statuses := make(chan string, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, results := upload(t, r, "same.png", data, nil)
+			if len(results) == 1 {
+				statuses <- results[0].Status
+			}
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	count := map[string]int{}
+	for status := range statuses {
+		count[status]++
+	}
+	if count[uploadCreated] != 1 || count[uploadDuplicate] != n-1 {
+		t.Fatalf("statuses = %v, want 1 created and %d duplicate", count, n-1)
+	}
+	if n, _ := models.ImagesCollection.CountDocuments(context.Background(), bson.M{}); n != 1 {
+		t.Errorf("%d image records, want 1", n)
+	}
+}
+
+func TestServeCacheControlForReencodedImages(t *testing.T) {
+	testutil.SetupDB(t)
+	testutil.SetupStorage(t, storage.BackendMem)
+	r := newImageRouter()
+
+	_, results := upload(t, r, "gradient.png", testPNG(t, 16, 16, 3), nil)
+	if len(results) != 1 || results[0].Status != uploadCreated {
+		t.Fatalf("upload failed: %+v", results)
+	}
+	hash := results[0].Hash
+
+	rec := serve(r, http.MethodGet, "/i/"+hash)
+	if cc := rec.Header().Get("Cache-Control"); cc != "public, max-age=31536000, immutable" {
+		t.Errorf("Cache-Control = %q, want immutable", cc)
+	}
+
+	// 重新编码过的图片在同一地址下内容会变化，不能标记为 immutable
+	_, err := models.ImagesCollection.UpdateOne(context.Background(), bson.M{"hash": hash},
+		bson.M{"$set": bson.M{"checksum": "0123456789abcdef0123456789abcdef"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = serve(r, http.MethodGet, "/i/"+hash)
+	if cc := rec.Header().Get("Cache-Control"); strings.Contains(cc, "immutable") || cc == "" {
+		t.Errorf("Cache-Control = %q for a re-encoded image", cc)
+	}
+	if etag := rec.Header().Get("ETag"); etag != `"0123456789abcdef0123456789abcdef"` {
+		t.Errorf("ETag = %s, want the checksum", etag)
+	}
+}
@@ -0,0 +1,47 @@
+// Package testutil 测试共用的辅助函数：临时数据库和内存存储后端
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
+)
+
+// SetupDB 连接 MONGODB_TEST_URI 指定的 MongoDB，使用独立的临时数据库，测试结束后删除
+//
+// 未设置 MONGODB_TEST_URI 时跳过测试
+func SetupDB(t *testing.T) {
+	t.Helper()
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	t.Setenv("MONGODB_URI", uri)
+	t.Setenv("MONGODB_DB_NAME", fmt.Sprintf("blog_api_test_%d", time.Now().UnixNano()))
+	if err := models.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+
+	db := models.DB
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = db.Drop(ctx)
+		_ = db.Client().Disconnect(ctx)
+	})
+}
+
+// SetupStorage 按 IMAGE_STORAGE=backend 初始化存储后端并返回默认后端，需要先调用 SetupDB
+func SetupStorage(t *testing.T, backend string) storage.ImageStore {
+	t.Helper()
+	t.Setenv("IMAGE_STORAGE", backend)
+	if err := storage.Init(); err != nil {
+		t.Fatalf("storage.Init: %v", err)
+	}
+	return storage.Default()
+}
@@ -0,0 +1,326 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/models"
+)
+
+// 任务状态
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// 单个条目的处理结果
+const (
+	ItemOK      = "ok"
+	ItemSkipped = "skipped"
+	ItemFailed  = "failed"
+)
+
+const (
+	defaultConcurrency = 2
+	// 进度最多每隔 flushInterval 写入一次数据库
+	flushInterval = time.Second
+	// 单个任务最多保存的逐条结果，避免超出 MongoDB 文档大小限制
+	maxResults = 10000
+)
+
+var (
+	// ErrNotFound 任务不存在
+	ErrNotFound = errors.New("job not found")
+	// ErrNotActive 任务已经结束，无法取消
+	ErrNotActive = errors.New("job is not queued or running")
+)
+
+// Func 任务的执行函数，ctx 在任务被取消时结束，此时应返回 ctx.Err()；返回 nil 的任务视为已完成
+type Func func(ctx context.Context, p *Progress) error
+
+var (
+	mu      sync.Mutex
+	cancels = make(map[string]context.CancelFunc)
+	slots   chan struct{}
+)
+
+// concurrency 同时运行的任务数，可通过 JOB_CONCURRENCY 配置
+func concurrency() int {
+	if value := os.Getenv("JOB_CONCURRENCY"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultConcurrency
+}
+
+// Init 初始化任务队列，并将上次进程退出时未完成的任务标记为失败
+func Init() error {
+	slots = make(chan struct{}, concurrency())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	now := time.Now()
+	result, err := models.JobsCollection.UpdateMany(ctx,
+		bson.M{"status": bson.M{"$in": bson.A{StatusQueued, StatusRunning}}},
+		bson.M{"$set": bson.M{
+			"status":     StatusFailed,
+			"error":      "Interrupted by server restart",
+			"finishedAt": now,
+			"updatedAt":  now,
+		}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to recover jobs: %v", err)
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Marked %d interrupted jobs as failed", result.ModifiedCount)
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Submit 创建任务并在后台排队执行，返回刚创建的任务
+func Submit(jobType string, params map[string]interface{}, fn Func) (models.Job, error) {
+	now := time.Now()
+	job := models.Job{
+		ID:        newID(),
+		Type:      jobType,
+		Status:    StatusQueued,
+		Params:    params,
+		Results:   []models.JobResult{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := models.JobsCollection.InsertOne(context.Background(), job); err != nil {
+		return job, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mu.Lock()
+	cancels[job.ID] = cancel
+	mu.Unlock()
+
+	p := &Progress{job: job}
+	go p.run(ctx, cancel, fn)
+	return job, nil
+}
+
+// Cancel 取消排队中或运行中的任务，任务函数需要检查 ctx 才能及时结束
+func Cancel(ctx context.Context, id string) error {
+	mu.Lock()
+	cancel, ok := cancels[id]
+	mu.Unlock()
+	if ok {
+		cancel()
+		return nil
+	}
+	if _, err := Get(ctx, id); err != nil {
+		return err
+	}
+	return ErrNotActive
+}
+
+// Get 按 ID 查询任务
+func Get(ctx context.Context, id string) (models.Job, error) {
+	var job models.Job
+	err := models.JobsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return job, ErrNotFound
+	}
+	return job, err
+}
+
+// List 按创建时间倒序列出任务，不包含逐条结果
+func List(ctx context.Context, status string, limit int) ([]models.Job, error) {
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetProjection(bson.M{"results": 0})
+	cursor, err := models.JobsCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	jobs := []models.Job{}
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Progress 任务执行过程中的计数器，定期写入数据库
+type Progress struct {
+	mu        sync.Mutex
+	job       models.Job
+	lastFlush time.Time
+
+	// flushMu 保证同一时间只有一次写入，flushed 为已经写入数据库的结果条数
+	flushMu sync.Mutex
+	flushed int
+}
+
+// SetTotal 设置需要处理的条目总数
+func (p *Progress) SetTotal(total int) {
+	p.mu.Lock()
+	p.job.Total = total
+	p.mu.Unlock()
+	p.flush(false)
+}
+
+// Count 只更新计数，不保存逐条结果
+func (p *Progress) Count(status string) {
+	p.mu.Lock()
+	p.count(status)
+	p.mu.Unlock()
+	p.flush(false)
+}
+
+// Record 更新计数并保存该条目的结果
+func (p *Progress) Record(result models.JobResult) {
+	p.mu.Lock()
+	p.count(result.Status)
+	if len(p.job.Results) < maxResults {
+		p.job.Results = append(p.job.Results, result)
+	}
+	p.mu.Unlock()
+	p.flush(false)
+}
+
+func (p *Progress) count(status string) {
+	p.job.Processed++
+	switch status {
+	case ItemOK:
+		p.job.Succeeded++
+	case ItemSkipped:
+		p.job.Skipped++
+	default:
+		p.job.Failed++
+	}
+}
+
+// flush 将当前进度写入数据库，force 为 false 时按 flushInterval 节流
+//
+// 计数器每次整体覆盖，逐条结果只追加上次写入之后新增的部分
+func (p *Progress) flush(force bool) {
+	p.mu.Lock()
+	now := time.Now()
+	if !force && now.Sub(p.lastFlush) < flushInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastFlush = now
+	p.mu.Unlock()
+
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+
+	p.mu.Lock()
+	p.job.UpdatedAt = now
+	update := bson.M{"$set": bson.M{
+		"status":     p.job.Status,
+		"total":      p.job.Total,
+		"processed":  p.job.Processed,
+		"succeeded":  p.job.Succeeded,
+		"skipped":    p.job.Skipped,
+		"failed":     p.job.Failed,
+		"error":      p.job.Error,
+		"startedAt":  p.job.StartedAt,
+		"finishedAt": p.job.FinishedAt,
+		"updatedAt":  now,
+	}}
+	pending := p.job.Results[p.flushed:]
+	if len(pending) > 0 {
+		update["$push"] = bson.M{"results": bson.M{"$each": pending}}
+	}
+	p.mu.Unlock()
+
+	// 任务的 ctx 可能已被取消，写入状态时使用独立的 ctx
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := models.JobsCollection.UpdateOne(ctx, bson.M{"_id": p.job.ID}, update); err != nil {
+		// 写入失败的结果留到下次一起追加
+		log.Printf("Failed to save job %s progress: %v", p.job.ID, err)
+		return
+	}
+	p.flushed += len(pending)
+}
+
+// setStatus 更新任务状态并立即写入数据库
+func (p *Progress) setStatus(status string, err error) {
+	now := time.Now()
+	p.mu.Lock()
+	p.job.Status = status
+	switch status {
+	case StatusRunning:
+		p.job.StartedAt = &now
+	default:
+		p.job.FinishedAt = &now
+	}
+	if err != nil {
+		p.job.Error = err.Error()
+	}
+	p.mu.Unlock()
+	p.flush(true)
+}
+
+// run 等待空闲的执行槽位后运行任务
+func (p *Progress) run(ctx context.Context, cancel context.CancelFunc, fn Func) {
+	defer func() {
+		mu.Lock()
+		delete(cancels, p.job.ID)
+		mu.Unlock()
+		cancel()
+	}()
+
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		p.setStatus(StatusCanceled, nil)
+		return
+	}
+	defer func() { <-slots }()
+
+	p.setStatus(StatusRunning, nil)
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return fn(ctx, p)
+	}()
+
+	// 以 fn 的返回值为准，fn 正常结束后才收到的取消请求不影响结果
+	switch {
+	case err == nil:
+		p.setStatus(StatusCompleted, nil)
+	case ctx.Err() != nil:
+		p.setStatus(StatusCanceled, nil)
+	default:
+		log.Printf("Job %s (%s) failed: %v", p.job.ID, p.job.Type, err)
+		p.setStatus(StatusFailed, err)
+	}
+}
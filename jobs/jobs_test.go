@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/models"
+)
+
+func setupJobs(t *testing.T) {
+	t.Helper()
+	testutil.SetupDB(t)
+	if err := Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+}
+
+func waitFinished(t *testing.T, id string) models.Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if job.FinishedAt != nil {
+			return job
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return models.Job{}
+}
+
+func TestJobResultsAreAppendedAcrossFlushes(t *testing.T) {
+	setupJobs(t)
+
+	flushed := make(chan struct{})
+	resume := make(chan struct{})
+	job, err := Submit("test", nil, func(ctx context.Context, p *Progress) error {
+		p.SetTotal(4)
+		p.Record(models.JobResult{Key: "a", Status: ItemOK})
+		p.Count(ItemSkipped)
+		// 等待节流间隔结束，下一条结果会触发一次中间写入
+		time.Sleep(flushInterval)
+		p.Record(models.JobResult{Key: "b", Status: ItemFailed, Reason: "broken"})
+		close(flushed)
+		<-resume
+		p.Record(models.JobResult{Key: "c", Status: ItemOK})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+
+	<-flushed
+	running, err := Get(context.Background(), job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if running.Status != StatusRunning || running.Processed != 3 || len(running.Results) != 2 {
+		t.Errorf("intermediate state = %+v, want running with 3 processed and 2 results", running)
+	}
+	close(resume)
+
+	finished := waitFinished(t, job.ID)
+	if finished.Status != StatusCompleted {
+		t.Fatalf("status = %s, want %s", finished.Status, StatusCompleted)
+	}
+	if finished.Total != 4 || finished.Processed != 4 || finished.Succeeded != 2 || finished.Skipped != 1 || finished.Failed != 1 {
+		t.Errorf("counters = %+v", finished)
+	}
+	var keys []string
+	for _, r := range finished.Results {
+		keys = append(keys, r.Key)
+	}
+	if fmt.Sprint(keys) != "[a b c]" {
+		t.Errorf("results = %v, want [a b c] without duplicates", keys)
+	}
+}
+
+func TestJobStatusFollowsFuncResult(t *testing.T) {
+	setupJobs(t)
+
+	failed, err := Submit("test", nil, func(ctx context.Context, p *Progress) error {
+		return errors.New("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job := waitFinished(t, failed.ID); job.Status != StatusFailed || job.Error != "boom" {
+		t.Errorf("failing job = %s %q, want failed with its error", job.Status, job.Error)
+	}
+
+	started := make(chan struct{})
+	canceled, err := Submit("test", nil, func(ctx context.Context, p *Progress) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := Cancel(context.Background(), canceled.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if job := waitFinished(t, canceled.ID); job.Status != StatusCanceled {
+		t.Errorf("canceled job status = %s", job.Status)
+	}
+	// 结束状态先于任务退出写入数据库，稍等任务从运行列表中移除
+	err = Cancel(context.Background(), canceled.ID)
+	for i := 0; err == nil && i < 50; i++ {
+		time.Sleep(10 * time.Millisecond)
+		err = Cancel(context.Background(), canceled.ID)
+	}
+	if err != ErrNotActive {
+		t.Errorf("Cancel finished job: err = %v, want ErrNotActive", err)
+	}
+	if err := Cancel(context.Background(), "missing"); err != ErrNotFound {
+		t.Errorf("Cancel missing job: err = %v, want ErrNotFound", err)
+	}
+}
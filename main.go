@@ -9,9 +9,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
+	"pysio.online/blog_api/auth"
 	"pysio.online/blog_api/handlers"
+	"pysio.online/blog_api/jobs"
 	"pysio.online/blog_api/middleware"
 	"pysio.online/blog_api/models"
+	"pysio.online/blog_api/storage"
 	"pysio.online/blog_api/utils"
 )
 
@@ -57,21 +60,12 @@ func getCurrentDir() string {
 	return dir
 }
 
+// logEnvironmentStatus 输出配置状态，机密变量只显示是否设置
 func logEnvironmentStatus() {
 	vars := []string{"TOKEN", "STEAM_API_KEY", "STEAM_ID", "MONGODB_URI", "ADMIN_TOKEN"}
 	log.Println("Environment variables status:")
 	for _, v := range vars {
-		value := os.Getenv(v)
-		if value != "" {
-			// 对于 TOKEN，显示具体值以便调试
-			if v == "TOKEN" {
-				log.Printf("%s: [Set: %s]", v, value)
-			} else {
-				log.Printf("%s: [Set]", v)
-			}
-		} else {
-			log.Printf("%s: [Not Set]", v)
-		}
+		log.Printf("%s: %s", v, utils.RedactedEnv(v))
 	}
 }
 
@@ -87,6 +81,11 @@ func init() {
 }
 
 func main() {
+	// 日志输出前替换机密值，避免令牌和密码出现在日志中
+	log.SetOutput(utils.NewRedactingWriter(os.Stderr))
+	gin.DefaultWriter = utils.NewRedactingWriter(os.Stdout)
+	gin.DefaultErrorWriter = utils.NewRedactingWriter(os.Stderr)
+
 	// 加载环境变量 - 移到最前面
 	loadEnv()
 
@@ -105,6 +104,25 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// 初始化图片存储后端
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to initialize image storage: %v", err)
+	}
+
+	// 初始化后台任务队列
+	if err := jobs.Init(); err != nil {
+		log.Fatalf("Failed to initialize jobs: %v", err)
+	}
+
+	// 定期清理回收站中过期的图片
+	handlers.StartTrashPurger()
+
+	// 定期清理没有完成的预签名上传
+	handlers.StartUploadSweeper()
+
+	// 定期清理超过保留时长的应用使用记录
+	handlers.StartPresenceHistoryPurger()
+
 	// 创建 Gin 实例
 	r := gin.Default()
 
@@ -121,12 +139,21 @@ func main() {
 		gitGroup.Any("/gitlab/*any", func(c *gin.Context) {})
 	}
 
+	// 按权限范围校验访问令牌
+	requireAdmin := middleware.RequireScope(auth.ScopeAdmin)
+	requireWrite := middleware.RequireScope(auth.ScopeImagesWrite)
+	requireDelete := middleware.RequireScope(auth.ScopeImagesDelete)
+	requireJobs := middleware.RequireScope(auth.ScopeAdminJobs)
+	requireStats := middleware.RequireScope(auth.ScopeStatsRead)
+
 	// 配置路由
 	r.GET("/", handlers.Home)
 	r.GET("/fastfetch", handlers.Fastfetch)
-	r.POST("/heartbeat", handlers.Heartbeat)
+	r.POST("/heartbeat", middleware.RequireScope(auth.ScopeHeartbeat), handlers.Heartbeat)
 	r.GET("/check", handlers.Check)
 	r.GET("/check/svg", handlers.CheckSVG)
+	r.GET("/check/history", handlers.CheckHistory)
+	r.GET("/check/timeline", handlers.CheckTimeline)
 	r.GET("/steam_status", handlers.SteamStatus)
 	r.GET("/ipcheck", handlers.IPCheck)
 	r.GET("/random_image", handlers.GetRandomImage)
@@ -134,10 +161,17 @@ func main() {
 	r.GET("/api_stats/:key", handlers.GetAPIStatsByKey)
 	r.GET("/images/count", handlers.GetImageCount)
 	r.GET("/images/list", handlers.GetImageList)
-	r.POST("/images/add", middleware.VerifyAdminToken(), handlers.AddImage)
-	r.DELETE("/images/:hash", middleware.VerifyAdminToken(), handlers.DeleteImage)
+	r.POST("/images/add", requireWrite, handlers.AddImage)
+	r.POST("/images/add/url", requireWrite, handlers.AddImageByURL)
+	r.DELETE("/images/:hash", requireDelete, handlers.DeleteImage)
 	r.GET("/images/:hash", handlers.GetImage)
+	r.GET("/images/:hash/meta", handlers.GetImageMeta)
+	r.PATCH("/images/:hash/meta", requireWrite, handlers.UpdateImageMeta)
+	r.HEAD("/images/:hash", handlers.GetImage)
 	r.GET("/i/:hash", handlers.GetImageByHash)
+	r.HEAD("/i/:hash", handlers.GetImageByHash)
+	r.GET("/albums", handlers.ListAlbums)
+	r.GET("/albums/:slug", handlers.GetAlbum)
 	r.GET("/egg", handlers.Egg)
 	r.GET("/404", handlers.NotFound)
 	r.GET("/50x", handlers.ServerError)
@@ -147,11 +181,33 @@ func main() {
 	// r.GET("/listdomain", middleware.ListDomains)
 	// r.GET("/domain/*domain", middleware.GetDomainDetails)
 
-	// 添加新的路由
+	// 管理接口，每个路由单独指定所需的权限范围
 	adminGroup := r.Group("/admin")
-	adminGroup.Use(middleware.VerifyAdminToken())
 	{
-		adminGroup.POST("/refcache", handlers.RefreshCache)
+		adminGroup.POST("/refcache", requireJobs, handlers.RefreshCache)
+		adminGroup.POST("/images/duplicates", requireJobs, handlers.FindDuplicateImages)
+		adminGroup.POST("/images/backfill", requireJobs, handlers.BackfillImageInfo)
+		// 旧地址，保留兼容
+		adminGroup.POST("/images/duplicates/backfill", requireJobs, handlers.BackfillImageInfo)
+		adminGroup.GET("/images/trash", requireDelete, handlers.ListTrash)
+		adminGroup.POST("/images/:hash/restore", requireDelete, handlers.RestoreImage)
+		adminGroup.POST("/images/bulk", middleware.RequireScope(auth.ScopeImagesWrite, auth.ScopeImagesDelete, auth.ScopeAdminJobs), handlers.BulkImages)
+		adminGroup.POST("/images/uploads", requireWrite, handlers.CreateUpload)
+		adminGroup.POST("/images/uploads/:ticket/finalize", requireWrite, handlers.FinalizeUpload)
+		adminGroup.GET("/cache", requireStats, handlers.GetCacheStats)
+		adminGroup.DELETE("/cache/:tier", requireAdmin, handlers.FlushCache)
+		adminGroup.GET("/jobs", requireJobs, handlers.ListJobs)
+		adminGroup.GET("/jobs/:id", requireJobs, handlers.GetJob)
+		adminGroup.POST("/jobs/:id/cancel", requireJobs, handlers.CancelJob)
+		adminGroup.POST("/albums", requireWrite, handlers.CreateAlbum)
+		adminGroup.PATCH("/albums/:slug", requireWrite, handlers.UpdateAlbum)
+		adminGroup.DELETE("/albums/:slug", requireWrite, handlers.DeleteAlbum)
+		adminGroup.POST("/albums/:slug/images", requireWrite, handlers.AddAlbumImages)
+		adminGroup.PUT("/albums/:slug/images", requireWrite, handlers.ReorderAlbumImages)
+		adminGroup.DELETE("/albums/:slug/images/:hash", requireWrite, handlers.RemoveAlbumImage)
+		adminGroup.GET("/keys", requireAdmin, handlers.ListAPIKeys)
+		adminGroup.POST("/keys", requireAdmin, handlers.CreateAPIKey)
+		adminGroup.DELETE("/keys/:id", requireAdmin, handlers.RevokeAPIKey)
 	}
 
 	// 启动服务器
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 认证失败的原因
+const (
+	authMissingToken = "missing_token"
+	authInvalidToken = "invalid_token"
+	authMissingScope = "missing_scope"
+	authError        = "error"
+)
+
+// authFailure 认证失败的审计记录，不包含任何令牌内容
+type authFailure struct {
+	Event  string    `json:"event"`
+	Time   time.Time `json:"time"`
+	IP     string    `json:"ip"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	KeyID  string    `json:"keyId,omitempty"`
+	Reason string    `json:"reason"`
+	Scope  string    `json:"scope,omitempty"`
+}
+
+// auditAuthFailure 以单行 JSON 记录认证失败，路径不包含查询参数
+func auditAuthFailure(c *gin.Context, keyID, reason, scope string) {
+	entry, err := json.Marshal(authFailure{
+		Event:  "auth_failure",
+		Time:   time.Now(),
+		IP:     c.ClientIP(),
+		Method: c.Request.Method,
+		Path:   c.Request.URL.Path,
+		KeyID:  keyID,
+		Reason: reason,
+		Scope:  scope,
+	})
+	if err != nil {
+		return
+	}
+	log.Printf("audit %s", entry)
+}
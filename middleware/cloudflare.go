@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"pysio.online/blog_api/utils"
 )
 
 // GraphQL 查询结构
@@ -207,7 +208,7 @@ func CloudflareStats(c *gin.Context) {
 			c.JSON(http.StatusOK, data)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": utils.Redact(err.Error())})
 		return
 	}
 
@@ -429,7 +430,7 @@ func ListDomains(c *gin.Context) {
 
 	data, err := getOrSetCache("domains_list", updateFunc)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": utils.Redact(err.Error())})
 		return
 	}
 
@@ -562,7 +563,7 @@ func GetDomainDetails(c *gin.Context) {
 			c.JSON(http.StatusOK, data)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": utils.Redact(err.Error())})
 		return
 	}
 
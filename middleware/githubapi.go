@@ -8,6 +8,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
+	"pysio.online/blog_api/utils"
 )
 
 // GithubAPIProxyMiddleware Github API 代理中间件
@@ -65,7 +66,7 @@ func GithubAPIProxyMiddleware() gin.HandlerFunc {
 		// 错误处理
 		proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
 			c.JSON(http.StatusBadGateway, gin.H{
-				"error": "Github API proxy error: " + err.Error(),
+				"error": utils.Redact("Github API proxy error: " + err.Error()),
 			})
 		}
 
@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"pysio.online/blog_api/utils"
 )
 
 // GitProxyMiddleware 处理 git clone 请求的中间件
@@ -72,7 +73,7 @@ func GitProxyMiddleware() gin.HandlerFunc {
 
 			proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
 				c.JSON(http.StatusBadGateway, gin.H{
-					"error": fmt.Sprintf("Git proxy error: %v", err),
+					"error": utils.Redact(fmt.Sprintf("Git proxy error: %v", err)),
 				})
 			}
 
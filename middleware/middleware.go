@@ -2,19 +2,20 @@ package middleware
 
 import (
 	"context"
-	"os"
+	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"pysio.online/blog_api/auth"
 	"pysio.online/blog_api/models"
 )
 
 func CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization")
 		c.Header("Access-Control-Max-Age", "86400")
 
@@ -27,18 +28,48 @@ func CORS() gin.HandlerFunc {
 	}
 }
 
-func VerifyAdminToken() gin.HandlerFunc {
+// PrincipalKey 认证通过后调用方信息在 gin.Context 中的键
+const PrincipalKey = "principal"
+
+// RequireScope 校验 Authorization 中的令牌，并要求拥有所有指定的权限范围
+func RequireScope(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader != "Bearer "+os.Getenv("ADMIN_TOKEN") {
-			c.JSON(401, gin.H{"error": "Unauthorized"})
-			c.Abort()
+		token := auth.BearerToken(c.GetHeader("Authorization"))
+		if token == "" {
+			auditAuthFailure(c, "", authMissingToken, "")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		// 失败响应中不包含任何令牌内容
+		principal, err := auth.Authenticate(c.Request.Context(), token)
+		if err != nil {
+			if err == auth.ErrInvalidToken {
+				auditAuthFailure(c, principal.KeyID, authInvalidToken, "")
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+				return
+			}
+			auditAuthFailure(c, principal.KeyID, authError, "")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
 			return
 		}
+		for _, scope := range scopes {
+			if !principal.HasScope(scope) {
+				auditAuthFailure(c, principal.KeyID, authMissingScope, scope)
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Missing scope: " + scope})
+				return
+			}
+		}
+		c.Set(PrincipalKey, principal)
 		c.Next()
 	}
 }
 
+// VerifyAdminToken 要求拥有 admin 权限
+func VerifyAdminToken() gin.HandlerFunc {
+	return RequireScope(auth.ScopeAdmin)
+}
+
 func CountAPICall() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		path := c.Request.URL.Path
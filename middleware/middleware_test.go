@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"pysio.online/blog_api/auth"
+	"pysio.online/blog_api/internal/testutil"
+)
+
+func TestRequireScopeDoesNotLeakSecrets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testutil.SetSecrets(t)
+
+	r := gin.New()
+	r.GET("/admin", RequireScope(auth.ScopeAdmin), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	tests := []struct {
+		name   string
+		url    string
+		header string
+		status int
+		reason string
+	}{
+		{"missing token", "/admin?token=" + testutil.AdminToken, "", http.StatusUnauthorized, authMissingToken},
+		{"invalid token", "/admin", "Bearer " + testutil.SteamAPIKey, http.StatusUnauthorized, authInvalidToken},
+		{"malformed api key", "/admin", "Bearer bak_zz_" + testutil.AdminToken, http.StatusUnauthorized, authInvalidToken},
+		{"missing scope", "/admin", "Bearer " + testutil.Token, http.StatusForbidden, authMissingScope},
+		{"authorized", "/admin", "Bearer " + testutil.AdminToken, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := testutil.CaptureLog(t)
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.reason != "" && !strings.Contains(logs.String(), `"reason":"`+tt.reason+`"`) {
+				t.Errorf("audit log missing reason %q: %s", tt.reason, logs.String())
+			}
+			testutil.AssertNoSecrets(t, "response body", w.Body.String())
+			testutil.AssertNoSecrets(t, "log output", logs.String())
+		})
+	}
+}
+
+func TestRequireScopeWithAPIKeys(t *testing.T) {
+	testutil.SetupDB(t)
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	r := gin.New()
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) }
+	r.POST("/images", RequireScope(auth.ScopeImagesWrite), ok)
+	r.DELETE("/images", RequireScope(auth.ScopeImagesWrite, auth.ScopeImagesDelete), ok)
+	r.GET("/admin", VerifyAdminToken(), ok)
+
+	_, writer, err := auth.Create(ctx, "writer", []string{auth.ScopeImagesWrite}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, admin, err := auth.Create(ctx, "admin", []string{auth.ScopeAdmin}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	_, expired, err := auth.Create(ctx, "expired", []string{auth.ScopeImagesWrite}, &past)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedKey, revoked, err := auth.Create(ctx, "revoked", []string{auth.ScopeImagesWrite}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Revoke(ctx, revokedKey.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+	}{
+		{"scoped key", http.MethodPost, "/images", writer, http.StatusOK},
+		{"all scopes required", http.MethodDelete, "/images", writer, http.StatusForbidden},
+		{"admin route", http.MethodGet, "/admin", writer, http.StatusForbidden},
+		{"admin key has every scope", http.MethodDelete, "/images", admin, http.StatusOK},
+		{"expired key", http.MethodPost, "/images", expired, http.StatusUnauthorized},
+		{"revoked key", http.MethodPost, "/images", revoked, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -3,17 +3,26 @@ package models
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
-	DB               *mongo.Database
-	ImagesCollection *mongo.Collection
-	CountsCollection *mongo.Collection
+	DB                 *mongo.Database
+	ImagesCollection   *mongo.Collection
+	CountsCollection   *mongo.Collection
+	AlbumsCollection   *mongo.Collection
+	JobsCollection     *mongo.Collection
+	UploadsCollection  *mongo.Collection
+	APIKeysCollection  *mongo.Collection
+	DevicesCollection  *mongo.Collection
+	SessionsCollection *mongo.Collection
 )
 
 type Image struct {
@@ -22,6 +31,164 @@ type Image struct {
 	ContentType string    `bson:"contentType"`
 	CreatedAt   time.Time `bson:"createdAt"`
 	UseS3       bool      `bson:"useS3"`
+	// Storage 图片数据所在的存储后端（mongo/s3/local），旧记录为空
+	Storage string `bson:"storage,omitempty"`
+
+	// 上传时提取的图片信息
+	Width          int    `bson:"width,omitempty"`
+	Height         int    `bson:"height,omitempty"`
+	Size           int64  `bson:"size,omitempty"`
+	OriginalFormat string `bson:"originalFormat,omitempty"`
+	OriginalName   string `bson:"originalName,omitempty"`
+	// SourceURL 通过远程地址上传时的原始地址
+	SourceURL     string `bson:"sourceUrl,omitempty"`
+	DominantColor string `bson:"dominantColor,omitempty"`
+	BlurHash      string `bson:"blurHash,omitempty"`
+	// PHash 感知哈希（dHash，16 位十六进制），用于查找相似图片
+	PHash string `bson:"phash,omitempty"`
+
+	// 动图信息，Duration 为一次播放的总时长（毫秒）
+	Animated   bool `bson:"animated,omitempty"`
+	FrameCount int  `bson:"frameCount,omitempty"`
+	Duration   int  `bson:"duration,omitempty"`
+
+	// 按 keep_exif 从 EXIF 中保留的字段，GPS 和相机信息不会保存
+	CapturedAt *time.Time `bson:"capturedAt,omitempty"`
+	Copyright  string     `bson:"copyright,omitempty"`
+
+	// Checksum 重新编码后图片数据的 MD5；Hash 作为访问地址保持不变，为空时与 Hash 相同
+	Checksum string `bson:"checksum,omitempty"`
+
+	// Rand 随机键，用于随机取图时按索引定位
+	Rand float64 `bson:"rand"`
+
+	// DeletedAt 移入回收站的时间，为空表示未删除
+	DeletedAt *time.Time `bson:"deletedAt,omitempty"`
+
+	// 管理员维护的描述信息
+	Tags  []string `bson:"tags,omitempty"`
+	Title string   `bson:"title,omitempty"`
+	Alt   string   `bson:"alt,omitempty"`
+}
+
+// Backend 返回图片数据所在的存储后端，兼容只有 useS3 字段的旧记录
+func (i *Image) Backend() string {
+	if i.Storage != "" {
+		return i.Storage
+	}
+	if i.UseS3 {
+		return "s3"
+	}
+	return "mongo"
+}
+
+// StorageFilter 按存储后端过滤图片记录，兼容只有 useS3 字段的旧记录
+func StorageFilter(backend string) bson.M {
+	legacy := bson.M{"storage": bson.M{"$in": bson.A{nil, ""}}}
+	switch backend {
+	case "s3":
+		legacy["useS3"] = true
+	case "mongo":
+		legacy["useS3"] = bson.M{"$ne": true}
+	default:
+		return bson.M{"storage": backend}
+	}
+	return bson.M{"$or": bson.A{bson.M{"storage": backend}, legacy}}
+}
+
+// Album 相册，Images 按显示顺序保存图片 hash
+type Album struct {
+	Slug        string    `bson:"slug"`
+	Title       string    `bson:"title"`
+	Description string    `bson:"description,omitempty"`
+	Cover       string    `bson:"cover,omitempty"`
+	Images      []string  `bson:"images"`
+	CreatedAt   time.Time `bson:"createdAt"`
+	UpdatedAt   time.Time `bson:"updatedAt"`
+}
+
+// JobResult 任务中单个条目的处理结果
+type JobResult struct {
+	Key    string `bson:"key"`
+	Status string `bson:"status"`
+	Reason string `bson:"reason,omitempty"`
+	// Related 与该条目相关的其他条目，如相似图片报告中与 Key 相似的图片
+	Related []RelatedItem `bson:"related,omitempty"`
+}
+
+// RelatedItem 任务结果中的相关条目，Distance 为感知哈希的汉明距离
+type RelatedItem struct {
+	Key      string `bson:"key"`
+	Distance int    `bson:"distance"`
+}
+
+// Job 后台任务的状态，由 jobs 包维护
+type Job struct {
+	ID     string `bson:"_id"`
+	Type   string `bson:"type"`
+	Status string `bson:"status"`
+	// Params 创建任务时的参数，仅用于展示
+	Params map[string]interface{} `bson:"params,omitempty"`
+
+	Total     int `bson:"total"`
+	Processed int `bson:"processed"`
+	Succeeded int `bson:"succeeded"`
+	Skipped   int `bson:"skipped"`
+	Failed    int `bson:"failed"`
+	// Results 逐条结果，部分任务只记录失败的条目
+	Results []JobResult `bson:"results"`
+	Error   string      `bson:"error,omitempty"`
+
+	CreatedAt  time.Time  `bson:"createdAt"`
+	StartedAt  *time.Time `bson:"startedAt,omitempty"`
+	FinishedAt *time.Time `bson:"finishedAt,omitempty"`
+	UpdatedAt  time.Time  `bson:"updatedAt"`
+}
+
+// UploadTicket 预签名上传的凭据，客户端上传到暂存对象后凭 ID 完成上传
+type UploadTicket struct {
+	ID       string `bson:"_id"`
+	Filename string `bson:"filename"`
+	// Options 创建凭据时指定的上传参数，与表单上传的字段相同
+	Options   map[string][]string `bson:"options,omitempty"`
+	CreatedAt time.Time           `bson:"createdAt"`
+	ExpiresAt time.Time           `bson:"expiresAt"`
+}
+
+// APIKey 带权限范围的访问密钥，只保存密钥的 SHA-256
+type APIKey struct {
+	ID         string     `bson:"_id"`
+	Name       string     `bson:"name"`
+	SecretHash string     `bson:"secretHash"`
+	Scopes     []string   `bson:"scopes"`
+	CreatedAt  time.Time  `bson:"createdAt"`
+	ExpiresAt  *time.Time `bson:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `bson:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `bson:"revokedAt,omitempty"`
+}
+
+// Device 通过心跳上报在线状态的设备，ID 由客户端指定
+type Device struct {
+	ID                string `bson:"_id"`
+	Application       string `bson:"application"`
+	Introduce         string `bson:"introduce"`
+	RGBA              string `bson:"rgba"`
+	ApplicationOnline bool   `bson:"applicationOnline"`
+	// Battery 电量百分比，客户端未上报时为空
+	Battery       *int      `bson:"battery,omitempty"`
+	Charging      *bool     `bson:"charging,omitempty"`
+	LastHeartbeat time.Time `bson:"lastHeartbeat"`
+	// SessionID 正在记录的应用使用时段，应用不在前台或不记录历史时为空
+	SessionID *primitive.ObjectID `bson:"sessionId,omitempty"`
+}
+
+// PresenceSession 设备连续使用同一个应用的时段，每次心跳延长 End
+type PresenceSession struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Device      string             `bson:"device"`
+	Application string             `bson:"application"`
+	Start       time.Time          `bson:"start"`
+	End         time.Time          `bson:"end"`
 }
 
 type Count struct {
@@ -61,6 +228,162 @@ func InitDB() error {
 	DB = client.Database(dbName)
 	ImagesCollection = DB.Collection("images")
 	CountsCollection = DB.Collection("counts")
+	AlbumsCollection = DB.Collection("albums")
+	JobsCollection = DB.Collection("jobs")
+	UploadsCollection = DB.Collection("uploads")
+	APIKeysCollection = DB.Collection("api_keys")
+	DevicesCollection = DB.Collection("devices")
+	SessionsCollection = DB.Collection("presence_sessions")
+
+	ensureIndexes()
 
 	return nil
 }
+
+// ensureIndexes 创建查询所需的索引，失败时只记录日志
+func ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := ImagesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "createdAt", Value: -1}, {Key: "hash", Value: -1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}}},
+		{Keys: bson.D{{Key: "rand", Value: 1}}},
+		{Keys: bson.D{{Key: "phash", Value: 1}}},
+		{Keys: bson.D{{Key: "deletedAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create image indexes: %v", err)
+	}
+	if err := ensureUniqueHash(ctx); err != nil {
+		log.Printf("Warning: Failed to create unique hash index: %v", err)
+	}
+
+	_, err = AlbumsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "images", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create album indexes: %v", err)
+	}
+
+	_, err = JobsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+		// 任务结束 30 天后自动删除，未结束的任务没有 finishedAt，不受影响
+		{Keys: bson.D{{Key: "finishedAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(30 * 24 * 3600)},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create job indexes: %v", err)
+	}
+
+	// 上传地址过期一小时后自动删除凭据，留出完成上传的时间
+	_, err = UploadsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(3600),
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create upload indexes: %v", err)
+	}
+
+	_, err = SessionsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "start", Value: 1}, {Key: "end", Value: 1}}},
+		{Keys: bson.D{{Key: "end", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create presence session indexes: %v", err)
+	}
+
+	// 旧版本在 MongoDB 存储下上传会留下只有 hash 和 data 的记录，补全创建时间和存储后端
+	result, err := ImagesCollection.UpdateMany(ctx,
+		bson.M{"createdAt": bson.M{"$exists": false}, "data": bson.M{"$exists": true}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"createdAt": bson.M{"$toDate": "$_id"},
+			"storage":   "mongo",
+		}}}},
+	)
+	if err != nil {
+		log.Printf("Warning: Failed to repair incomplete image records: %v", err)
+	} else if result.ModifiedCount > 0 {
+		log.Printf("Repaired %d incomplete image records", result.ModifiedCount)
+	}
+
+	// 为旧记录补充随机键（需要 MongoDB 4.4.2+）
+	result, err = ImagesCollection.UpdateMany(ctx,
+		bson.M{"rand": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"rand": bson.M{"$rand": bson.M{}}}}}},
+	)
+	if err != nil {
+		log.Printf("Warning: Failed to backfill image random keys: %v", err)
+	} else if result.ModifiedCount > 0 {
+		log.Printf("Backfilled random keys for %d images", result.ModifiedCount)
+	}
+}
+
+// ensureUniqueHash 为 images.hash 建立唯一索引，上传依赖它拒绝同时进行的相同上传
+//
+// 旧版本的 hash 索引不是唯一的，可能已经存在重复记录：每个 hash 保留一条（优先不在回收站中、创建最早的），
+// 删除其余记录后再替换索引。对象以 hash 为键，由保留的记录共用，不需要删除
+func ensureUniqueHash(ctx context.Context) error {
+	specs, err := ImagesCollection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+	hasIndex := false
+	for _, spec := range specs {
+		if spec.Name != "hash_1" {
+			continue
+		}
+		if spec.Unique != nil && *spec.Unique {
+			return nil
+		}
+		hasIndex = true
+	}
+
+	// 按 hash 排序遍历，同一 hash 的第一条记录保留，其余的删除
+	cursor, err := ImagesCollection.Find(ctx, bson.M{}, options.Find().
+		SetProjection(bson.M{"hash": 1, "deletedAt": 1, "createdAt": 1}).
+		SetSort(bson.D{{Key: "hash", Value: 1}, {Key: "deletedAt", Value: 1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+		SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var duplicates []interface{}
+	previous := ""
+	for i := 0; cursor.Next(ctx); i++ {
+		var doc struct {
+			ID   interface{} `bson:"_id"`
+			Hash string      `bson:"hash"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if i > 0 && doc.Hash == previous {
+			duplicates = append(duplicates, doc.ID)
+		}
+		previous = doc.Hash
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		result, err := ImagesCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": duplicates}})
+		if err != nil {
+			return err
+		}
+		log.Printf("Removed %d duplicate image records", result.DeletedCount)
+	}
+
+	if hasIndex {
+		if _, err := ImagesCollection.Indexes().DropOne(ctx, "hash_1"); err != nil {
+			return err
+		}
+	}
+	_, err = ImagesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
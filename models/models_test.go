@@ -0,0 +1,60 @@
+package models_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"pysio.online/blog_api/internal/testutil"
+	"pysio.online/blog_api/models"
+)
+
+func TestInitDBDeduplicatesImagesBeforeUniqueIndex(t *testing.T) {
+	testutil.SetupDB(t)
+	ctx := context.Background()
+
+	// 模拟旧版本：普通 hash 索引和重复记录
+	if _, err := models.ImagesCollection.Indexes().DropOne(ctx, "hash_1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := models.ImagesCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "hash", Value: 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	deletedAt := now
+	_, err := models.ImagesCollection.InsertMany(ctx, []interface{}{
+		models.Image{Hash: "a", CreatedAt: now.Add(-time.Hour), DeletedAt: &deletedAt},
+		models.Image{Hash: "a", CreatedAt: now, Title: "keep"},
+		models.Image{Hash: "a", CreatedAt: now.Add(time.Hour)},
+		models.Image{Hash: "b", CreatedAt: now},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := models.InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+
+	var images []models.Image
+	cursor, err := models.ImagesCollection.Find(ctx, bson.M{"hash": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cursor.All(ctx, &images); err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].Title != "keep" {
+		t.Fatalf("records for duplicated hash = %+v, want only the oldest one outside the trash", images)
+	}
+	if n, _ := models.ImagesCollection.CountDocuments(ctx, bson.M{"hash": "b"}); n != 1 {
+		t.Errorf("%d records for hash b, want 1", n)
+	}
+
+	_, err = models.ImagesCollection.InsertOne(ctx, models.Image{Hash: "b", CreatedAt: now})
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("inserting an existing hash: err = %v, want duplicate key error", err)
+	}
+}
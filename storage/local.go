@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultLocalStorageDir = "./data/images"
+
+// LocalStore 将图片保存到本地文件系统，文件名为 hash.webp
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore 创建本地存储，dir 为空时使用 ./data/images
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if dir == "" {
+		dir = defaultLocalStorageDir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	return &LocalStore{dir: dir}, nil
+}
+
+func (s *LocalStore) Name() string {
+	return BackendLocal
+}
+
+func (s *LocalStore) path(hash string) string {
+	return filepath.Join(s.dir, objectKey(filepath.Base(hash)))
+}
+
+func (s *LocalStore) Put(ctx context.Context, hash string, data []byte, contentType string) error {
+	// 先写临时文件再重命名，避免读到写了一半的文件
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(hash))
+}
+
+func (s *LocalStore) Get(ctx context.Context, hash string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(hash))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, hash string) error {
+	err := os.Remove(s.path(hash))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStore) Stat(ctx context.Context, hash string) (ObjectInfo, error) {
+	info, err := os.Stat(s.path(hash))
+	if os.IsNotExist(err) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Hash:         hash,
+		Size:         info.Size(),
+		ContentType:  "image/webp",
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func (s *LocalStore) List(ctx context.Context, fn func(ObjectInfo) error) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".webp") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		err = fn(ObjectInfo{
+			Hash:         strings.TrimSuffix(name, ".webp"),
+			Size:         info.Size(),
+			ContentType:  "image/webp",
+			LastModified: info.ModTime(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// MemoryStore 基于内存的存储后端，用于测试和本地调试
+type MemoryStore struct {
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{objects: make(map[string]memoryObject)}
+}
+
+func (s *MemoryStore) Name() string {
+	return BackendMem
+}
+
+func (s *MemoryStore) Put(ctx context.Context, hash string, data []byte, contentType string) error {
+	buf := make([]byte, len(data))
+	copy(buf, data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[hash] = memoryObject{data: buf, contentType: contentType, modTime: time.Now()}
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, hash string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	buf := make([]byte, len(obj.data))
+	copy(buf, obj.data)
+	return buf, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, hash)
+	return nil
+}
+
+func (s *MemoryStore) Stat(ctx context.Context, hash string) (ObjectInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[hash]
+	if !ok {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return ObjectInfo{
+		Hash:         hash,
+		Size:         int64(len(obj.data)),
+		ContentType:  obj.contentType,
+		LastModified: obj.modTime,
+	}, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, fn func(ObjectInfo) error) error {
+	s.mu.RLock()
+	infos := make([]ObjectInfo, 0, len(s.objects))
+	for hash, obj := range s.objects {
+		infos = append(infos, ObjectInfo{
+			Hash:         hash,
+			Size:         int64(len(obj.data)),
+			ContentType:  obj.contentType,
+			LastModified: obj.modTime,
+		})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Hash < infos[j].Hash })
+	for _, info := range infos {
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// MinioStore 将图片保存到 Minio/S3 存储桶，对象名为 hash.webp
+type MinioStore struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewMinioStore(client *minio.Client, bucket string) *MinioStore {
+	return &MinioStore{client: client, bucket: bucket}
+}
+
+// NewMinioStoreFromEnv 根据 MINIO_* 环境变量创建客户端，并确保存储桶存在
+func NewMinioStoreFromEnv() (*MinioStore, error) {
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	accessKey := os.Getenv("MINIO_ACCESS_KEY")
+	secretKey := os.Getenv("MINIO_SECRET_KEY")
+	bucket := os.Getenv("MINIO_BUCKET")
+
+	// 验证必需的环境变量
+	if endpoint == "" || accessKey == "" || secretKey == "" || bucket == "" {
+		return nil, fmt.Errorf("missing required Minio environment variables (MINIO_ENDPOINT: %v, MINIO_ACCESS_KEY: %v, MINIO_SECRET_KEY: %v, MINIO_BUCKET: %v)",
+			endpoint != "", accessKey != "", secretKey != "", bucket != "")
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: os.Getenv("MINIO_USE_SSL") == "true",
+		Region: os.Getenv("MINIO_REGION"),
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+			MaxIdleConns:       100,
+			IdleConnTimeout:    90 * time.Second,
+			DisableCompression: true,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Minio client: %v", err)
+	}
+
+	// 测试连接
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket existence: %v", err)
+	}
+	if !exists {
+		err = client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{
+			Region: os.Getenv("MINIO_REGION"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create bucket: %v", err)
+		}
+	}
+
+	return NewMinioStore(client, bucket), nil
+}
+
+func (s *MinioStore) Name() string {
+	return BackendS3
+}
+
+// Client 返回底层 Minio 客户端
+func (s *MinioStore) Client() *minio.Client {
+	return s.client
+}
+
+// Bucket 返回存储桶名称
+func (s *MinioStore) Bucket() string {
+	return s.bucket
+}
+
+func objectKey(hash string) string {
+	return hash + ".webp"
+}
+
+func (s *MinioStore) Put(ctx context.Context, hash string, data []byte, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, objectKey(hash), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+func (s *MinioStore) Get(ctx context.Context, hash string) ([]byte, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, objectKey(hash), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, convertMinioError(err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		return nil, convertMinioError(err)
+	}
+	return data, nil
+}
+
+func (s *MinioStore) Delete(ctx context.Context, hash string) error {
+	return s.client.RemoveObject(ctx, s.bucket, objectKey(hash), minio.RemoveObjectOptions{})
+}
+
+func (s *MinioStore) Stat(ctx context.Context, hash string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, objectKey(hash), minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, convertMinioError(err)
+	}
+	return ObjectInfo{
+		Hash:         hash,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func (s *MinioStore) List(ctx context.Context, fn func(ObjectInfo) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		// 跳过非图片对象（例如权限测试文件）
+		if !strings.HasSuffix(obj.Key, ".webp") || strings.Contains(obj.Key, "/") {
+			continue
+		}
+		err := fn(ObjectInfo{
+			Hash:         strings.TrimSuffix(obj.Key, ".webp"),
+			Size:         obj.Size,
+			ContentType:  obj.ContentType,
+			LastModified: obj.LastModified,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func convertMinioError(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
+
+// UploadPrefix 预签名上传的暂存目录，List 不会列出其中的对象
+const UploadPrefix = "uploads/"
+
+// PresignGet 返回图片的限时下载地址
+func (s *MinioStore) PresignGet(ctx context.Context, hash string, expiry time.Duration) (*url.URL, error) {
+	return s.client.PresignedGetObject(ctx, s.bucket, objectKey(hash), expiry, nil)
+}
+
+// PresignUpload 返回暂存对象的限时上传地址，客户端通过 PUT 直接上传到存储桶
+func (s *MinioStore) PresignUpload(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	return s.client.PresignedPutObject(ctx, s.bucket, UploadPrefix+key, expiry)
+}
+
+// GetUpload 读取暂存对象，超过 maxSize 时返回错误而不读取内容
+func (s *MinioStore) GetUpload(ctx context.Context, key string, maxSize int64) ([]byte, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, UploadPrefix+key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, convertMinioError(err)
+	}
+	if info.Size > maxSize {
+		return nil, fmt.Errorf("file too large: limit is %d bytes", maxSize)
+	}
+
+	obj, err := s.client.GetObject(ctx, s.bucket, UploadPrefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, convertMinioError(err)
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(io.LimitReader(obj, maxSize+1))
+	if err != nil {
+		return nil, convertMinioError(err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("file too large: limit is %d bytes", maxSize)
+	}
+	return data, nil
+}
+
+func (s *MinioStore) DeleteUpload(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, UploadPrefix+key, minio.RemoveObjectOptions{})
+}
+
+// PurgeUploads 删除 before 之前写入的暂存对象，返回删除数量
+func (s *MinioStore) PurgeUploads(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: UploadPrefix, Recursive: true}) {
+		if obj.Err != nil {
+			return purged, obj.Err
+		}
+		if obj.LastModified.After(before) {
+			continue
+		}
+		if err := s.client.RemoveObject(ctx, s.bucket, obj.Key, minio.RemoveObjectOptions{}); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
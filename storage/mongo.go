@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore 将图片数据内联保存在 images 集合的 data 字段中
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStore(collection *mongo.Collection) *MongoStore {
+	return &MongoStore{collection: collection}
+}
+
+func (s *MongoStore) Name() string {
+	return BackendMongo
+}
+
+// Put 把数据写入已有记录的 data 字段，不会创建记录；记录不存在时返回 ErrNotFound，调用方需先插入图片记录
+func (s *MongoStore) Put(ctx context.Context, hash string, data []byte, contentType string) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"hash": hash},
+		bson.M{"$set": bson.M{"data": data, "contentType": contentType}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) Get(ctx context.Context, hash string) ([]byte, error) {
+	var doc struct {
+		Data []byte `bson:"data"`
+	}
+	err := s.collection.FindOne(ctx, bson.M{"hash": hash},
+		options.FindOne().SetProjection(bson.M{"data": 1})).Decode(&doc)
+	if err == mongo.ErrNoDocuments || (err == nil && len(doc.Data) == 0) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Data, nil
+}
+
+// Delete 只移除图片数据，记录本身由调用方负责删除
+func (s *MongoStore) Delete(ctx context.Context, hash string) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"hash": hash},
+		bson.M{"$unset": bson.M{"data": ""}},
+	)
+	return err
+}
+
+func (s *MongoStore) Stat(ctx context.Context, hash string) (ObjectInfo, error) {
+	cursor, err := s.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"hash": hash, "data": bson.M{"$exists": true, "$ne": nil}}}},
+		{{Key: "$project", Value: bson.M{
+			"hash":        1,
+			"contentType": 1,
+			"createdAt":   1,
+			"size":        bson.M{"$binarySize": "$data"},
+		}}},
+		{{Key: "$limit", Value: 1}},
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return ObjectInfo{}, err
+		}
+		return ObjectInfo{}, ErrNotFound
+	}
+	return decodeObjectInfo(cursor)
+}
+
+func (s *MongoStore) List(ctx context.Context, fn func(ObjectInfo) error) error {
+	cursor, err := s.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"data": bson.M{"$exists": true, "$ne": nil}}}},
+		{{Key: "$project", Value: bson.M{
+			"hash":        1,
+			"contentType": 1,
+			"createdAt":   1,
+			"size":        bson.M{"$binarySize": "$data"},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		info, err := decodeObjectInfo(cursor)
+		if err != nil {
+			return err
+		}
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func decodeObjectInfo(cursor *mongo.Cursor) (ObjectInfo, error) {
+	var doc struct {
+		Hash        string    `bson:"hash"`
+		ContentType string    `bson:"contentType"`
+		CreatedAt   time.Time `bson:"createdAt"`
+		Size        int64     `bson:"size"`
+	}
+	if err := cursor.Decode(&doc); err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Hash:         doc.Hash,
+		Size:         doc.Size,
+		ContentType:  doc.ContentType,
+		LastModified: doc.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"pysio.online/blog_api/models"
+)
+
+// 存储后端名称，与 models.Image.Storage 字段保持一致
+const (
+	BackendMongo = "mongo"
+	BackendS3    = "s3"
+	BackendLocal = "local"
+	BackendMem   = "memory"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo 存储对象的基本信息
+type ObjectInfo struct {
+	Hash         string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// ImageStore 图片存储后端接口，所有对象均以图片 hash 作为键
+type ImageStore interface {
+	// Name 返回后端名称
+	Name() string
+	// Put 写入对象，已存在时覆盖
+	Put(ctx context.Context, hash string, data []byte, contentType string) error
+	// Get 读取对象内容，不存在时返回 ErrNotFound
+	Get(ctx context.Context, hash string) ([]byte, error)
+	// Delete 删除对象，不存在时不报错
+	Delete(ctx context.Context, hash string) error
+	// Stat 获取对象信息，不存在时返回 ErrNotFound
+	Stat(ctx context.Context, hash string) (ObjectInfo, error)
+	// List 遍历所有对象，fn 返回错误时中止遍历
+	List(ctx context.Context, fn func(ObjectInfo) error) error
+}
+
+var (
+	storesMu     sync.RWMutex
+	stores       = make(map[string]ImageStore)
+	defaultStore string
+)
+
+// Register 注册存储后端，同名后端会被替换
+func Register(store ImageStore) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	stores[store.Name()] = store
+}
+
+// SetDefault 设置新图片写入时使用的后端
+func SetDefault(name string) error {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	if _, ok := stores[name]; !ok {
+		return fmt.Errorf("storage backend %q is not registered", name)
+	}
+	defaultStore = name
+	return nil
+}
+
+// Get 按名称获取存储后端
+func Get(name string) (ImageStore, error) {
+	storesMu.RLock()
+	defer storesMu.RUnlock()
+	store, ok := stores[name]
+	if !ok {
+		return nil, fmt.Errorf("storage backend %q is not available", name)
+	}
+	return store, nil
+}
+
+// Default 返回默认存储后端
+func Default() ImageStore {
+	storesMu.RLock()
+	defer storesMu.RUnlock()
+	return stores[defaultStore]
+}
+
+// ForImage 返回保存该图片记录的存储后端
+func ForImage(image *models.Image) (ImageStore, error) {
+	return Get(image.Backend())
+}
+
+// Init 根据环境变量注册可用的存储后端并选择默认后端
+//
+// IMAGE_STORAGE 可选 mongo、s3、local、memory，未设置时沿用 USE_MINIO_STORAGE 的行为；
+// memory 的数据在进程退出后丢失，只用于测试和本地调试
+func Init() error {
+	// MongoDB 内联存储始终可用，用于读取历史数据
+	Register(NewMongoStore(models.ImagesCollection))
+
+	backend := os.Getenv("IMAGE_STORAGE")
+	if backend == "" {
+		if os.Getenv("USE_MINIO_STORAGE") == "true" {
+			backend = BackendS3
+		} else {
+			backend = BackendMongo
+		}
+	}
+
+	// 配置了 Minio 时注册 S3 后端，便于读取已迁移到 Minio 的图片
+	if os.Getenv("MINIO_ENDPOINT") != "" || backend == BackendS3 {
+		store, err := NewMinioStoreFromEnv()
+		if err != nil {
+			if backend == BackendS3 {
+				return fmt.Errorf("failed to initialize Minio storage: %v", err)
+			}
+			log.Printf("Warning: Minio storage unavailable: %v", err)
+		} else {
+			Register(store)
+		}
+	}
+
+	if dir := os.Getenv("LOCAL_STORAGE_DIR"); dir != "" || backend == BackendLocal {
+		store, err := NewLocalStore(dir)
+		if err != nil {
+			if backend == BackendLocal {
+				return fmt.Errorf("failed to initialize local storage: %v", err)
+			}
+			log.Printf("Warning: Local storage unavailable: %v", err)
+		} else {
+			Register(store)
+		}
+	}
+
+	if backend == BackendMem {
+		Register(NewMemoryStore())
+	}
+
+	if err := SetDefault(backend); err != nil {
+		return err
+	}
+
+	log.Printf("Image storage backend: %s", backend)
+	return nil
+}
@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/gif"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+const (
+	webpFlagAnimation = 0x02
+	webpFlagAlpha     = 0x10
+	// ANMF 中的帧时长只有 24 位
+	maxWebPFrameDuration = 1<<24 - 1
+)
+
+// AnimationInfo 动图的帧数和总时长
+type AnimationInfo struct {
+	Frames int
+	// Duration 一次播放的总时长（毫秒）
+	Duration int
+	// Loop 循环次数，0 表示无限循环
+	Loop int
+}
+
+// DetectAnimation 判断图片是否为多帧的 GIF 或 WebP 动图
+func DetectAnimation(buffer []byte) (AnimationInfo, bool) {
+	switch {
+	case bytes.HasPrefix(buffer, []byte("GIF8")):
+		g, err := gif.DecodeAll(bytes.NewReader(buffer))
+		if err != nil || len(g.Image) < 2 {
+			return AnimationInfo{}, false
+		}
+		info := AnimationInfo{Frames: len(g.Image), Loop: webpLoopCount(g.LoopCount)}
+		for _, delay := range g.Delay {
+			info.Duration += gifDelayMillis(delay)
+		}
+		return info, true
+	case isWebP(buffer):
+		chunks := webpChunks(buffer)
+		if len(chunks) == 0 || chunks[0].fourCC != "VP8X" || len(chunks[0].payload) < 1 ||
+			chunks[0].payload[0]&webpFlagAnimation == 0 {
+			return AnimationInfo{}, false
+		}
+		var info AnimationInfo
+		for _, chunk := range chunks {
+			switch {
+			case chunk.fourCC == "ANIM" && len(chunk.payload) >= 6:
+				info.Loop = int(binary.LittleEndian.Uint16(chunk.payload[4:]))
+			case chunk.fourCC == "ANMF" && len(chunk.payload) >= 16:
+				info.Frames++
+				info.Duration += int(uint24(chunk.payload[12:]))
+			}
+		}
+		return info, info.Frames > 1
+	}
+	return AnimationInfo{}, false
+}
+
+func isWebP(buffer []byte) bool {
+	return len(buffer) > 12 && string(buffer[:4]) == "RIFF" && string(buffer[8:12]) == "WEBP"
+}
+
+// gifDelayMillis 与浏览器行为一致，小于 20ms 的帧间隔按 100ms 处理
+func gifDelayMillis(delay int) int {
+	if delay < 2 {
+		return 100
+	}
+	return delay * 10
+}
+
+// webpLoopCount 将 GIF 的 LoopCount 转换为 WebP 的循环次数
+func webpLoopCount(gifLoop int) int {
+	switch {
+	case gifLoop == 0:
+		return 0
+	case gifLoop < 0:
+		return 1
+	default:
+		return gifLoop + 1
+	}
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
+
+// firstWebPFrame 将 WebP 动图的第一帧封装为独立的 WebP，用于解码分析
+func firstWebPFrame(buffer []byte) ([]byte, error) {
+	for _, chunk := range webpChunks(buffer) {
+		if chunk.fourCC != "ANMF" || len(chunk.payload) < 16 {
+			continue
+		}
+		width, height := uint24(chunk.payload[6:])+1, uint24(chunk.payload[9:])+1
+		frame := chunk.payload[16:]
+
+		var out bytes.Buffer
+		out.Write([]byte("RIFF\x00\x00\x00\x00WEBP"))
+		if bytes.HasPrefix(frame, []byte("VP8L")) {
+			out.Write(frame)
+		} else {
+			vp8x := make([]byte, 18)
+			copy(vp8x, "VP8X")
+			binary.LittleEndian.PutUint32(vp8x[4:], 10)
+			if bytes.HasPrefix(frame, []byte("ALPH")) {
+				vp8x[8] = webpFlagAlpha
+			}
+			putUint24(vp8x[12:], width-1)
+			putUint24(vp8x[15:], height-1)
+			out.Write(vp8x)
+			out.Write(frame)
+		}
+		result := out.Bytes()
+		binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+		return result, nil
+	}
+	return nil, fmt.Errorf("no animation frame found")
+}
+
+// EncodeAnimatedWebP 将 GIF 动图转换为 WebP 动图，WebP 动图只去除元数据
+//
+// 每一帧都合成为完整画布后以无损格式编码，保证与原图的显示效果一致
+func EncodeAnimatedWebP(buffer []byte) ([]byte, error) {
+	if isWebP(buffer) {
+		return StripWebPMetadata(buffer, false), nil
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(buffer))
+	if err != nil {
+		return nil, fmt.Errorf("decode gif failed: %v", err)
+	}
+	width, height := g.Config.Width, g.Config.Height
+	if width == 0 || height == 0 {
+		width, height = g.Image[0].Bounds().Dx(), g.Image[0].Bounds().Dy()
+	}
+
+	var frames bytes.Buffer
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i, frame := range g.Image {
+		var previous *image.NRGBA
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewNRGBA(canvas.Rect)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		var encoded bytes.Buffer
+		if err := nativewebp.Encode(&encoded, canvas, nil); err != nil {
+			return nil, fmt.Errorf("encode frame %d failed: %v", i, err)
+		}
+		// 去掉 RIFF 头，只保留 VP8L 数据块
+		bitstream := encoded.Bytes()[12:]
+
+		duration := 100
+		if i < len(g.Delay) {
+			duration = gifDelayMillis(g.Delay[i])
+		}
+		if duration > maxWebPFrameDuration {
+			duration = maxWebPFrameDuration
+		}
+
+		header := make([]byte, 24)
+		copy(header, "ANMF")
+		binary.LittleEndian.PutUint32(header[4:], uint32(16+len(bitstream)))
+		// 帧位置为 (0, 0)，尺寸为整个画布
+		putUint24(header[14:], uint32(width-1))
+		putUint24(header[17:], uint32(height-1))
+		putUint24(header[20:], uint32(duration))
+		// 每帧都是完整画布，不与上一帧混合
+		header[23] = 0x02
+		frames.Write(header)
+		frames.Write(bitstream)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			copy(canvas.Pix, previous.Pix)
+		}
+	}
+
+	var out bytes.Buffer
+	out.Write([]byte("RIFF\x00\x00\x00\x00WEBP"))
+
+	vp8x := make([]byte, 18)
+	copy(vp8x, "VP8X")
+	binary.LittleEndian.PutUint32(vp8x[4:], 10)
+	vp8x[8] = webpFlagAnimation | webpFlagAlpha
+	putUint24(vp8x[12:], uint32(width-1))
+	putUint24(vp8x[15:], uint32(height-1))
+	out.Write(vp8x)
+
+	anim := make([]byte, 14)
+	copy(anim, "ANIM")
+	binary.LittleEndian.PutUint32(anim[4:], 6)
+	binary.LittleEndian.PutUint16(anim[12:], uint16(webpLoopCount(g.LoopCount)))
+	out.Write(anim)
+
+	out.Write(frames.Bytes())
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result, nil
+}
@@ -0,0 +1,87 @@
+package utils
+
+// BKTree 以汉明距离组织感知哈希的 BK 树，查找时只访问可能在阈值以内的分支
+//
+// 不是并发安全的，需要由调用方加锁
+type BKTree struct {
+	root *bkNode
+	size int
+}
+
+type bkNode struct {
+	key      string
+	value    uint64
+	children []bkChild
+}
+
+type bkChild struct {
+	distance int
+	node     *bkNode
+}
+
+// BKMatch 查找结果，Distance 为与目标哈希的汉明距离
+type BKMatch struct {
+	Key      string
+	Distance int
+}
+
+// Len 返回树中的哈希数量
+func (t *BKTree) Len() int {
+	return t.size
+}
+
+// Add 加入一个哈希，相同的 key 重复加入时会保存多份
+func (t *BKTree) Add(key string, value uint64) {
+	node := &bkNode{key: key, value: value}
+	t.size++
+	if t.root == nil {
+		t.root = node
+		return
+	}
+
+	current := t.root
+	for {
+		distance := HammingDistance(current.value, value)
+		next := current.child(distance)
+		if next == nil {
+			current.children = append(current.children, bkChild{distance: distance, node: node})
+			return
+		}
+		current = next
+	}
+}
+
+func (n *bkNode) child(distance int) *bkNode {
+	for _, c := range n.children {
+		if c.distance == distance {
+			return c.node
+		}
+	}
+	return nil
+}
+
+// Search 返回与 value 距离不超过 threshold 的所有哈希，顺序不固定
+func (t *BKTree) Search(value uint64, threshold int) []BKMatch {
+	var matches []BKMatch
+	if t.root == nil {
+		return matches
+	}
+
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		distance := HammingDistance(node.value, value)
+		if distance <= threshold {
+			matches = append(matches, BKMatch{Key: node.key, Distance: distance})
+		}
+		// 三角不等式：只有与当前节点距离在 [distance-threshold, distance+threshold] 内的子树可能命中
+		for _, c := range node.children {
+			if c.distance >= distance-threshold && c.distance <= distance+threshold {
+				stack = append(stack, c.node)
+			}
+		}
+	}
+	return matches
+}
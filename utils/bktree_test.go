@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestBKTreeSearchMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	values := make([]uint64, 2000)
+	var tree BKTree
+	for i := range values {
+		// 一部分哈希由前面的哈希翻转少量位得到，模拟相似图片
+		if i > 0 && i%3 == 0 {
+			values[i] = values[rng.Intn(i)] ^ (1 << rng.Intn(64)) ^ (1 << rng.Intn(64))
+		} else {
+			values[i] = rng.Uint64()
+		}
+		tree.Add(fmt.Sprint(i), values[i])
+	}
+	if tree.Len() != len(values) {
+		t.Fatalf("Len = %d, want %d", tree.Len(), len(values))
+	}
+
+	for _, threshold := range []int{0, 3, 10} {
+		for q := 0; q < 50; q++ {
+			target := values[rng.Intn(len(values))] ^ (1 << rng.Intn(64))
+
+			var want []string
+			for i, v := range values {
+				if HammingDistance(v, target) <= threshold {
+					want = append(want, strconv.Itoa(i))
+				}
+			}
+			var got []string
+			for _, m := range tree.Search(target, threshold) {
+				i, _ := strconv.Atoi(m.Key)
+				if m.Distance != HammingDistance(values[i], target) {
+					t.Fatalf("wrong distance for %s", m.Key)
+				}
+				got = append(got, m.Key)
+			}
+			sort.Strings(want)
+			sort.Strings(got)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("threshold %d: Search = %v, want %v", threshold, got, want)
+			}
+		}
+	}
+}
@@ -1,65 +1,412 @@
 package utils
 
 import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
 	"fmt"
-	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var (
-	cacheDir = "./cache"
-	// 当使用 Minio 时禁用缓存
-	cacheEnabled = os.Getenv("USE_MINIO_STORAGE") != "true"
+const (
+	defaultCacheDir     = "./cache"
+	defaultCacheMaxSize = 1 << 30
+
+	// 缓存文件格式：4 字节标识 + SHA-256 校验和 + 数据
+	cacheMagic      = "BIC1"
+	cacheHeaderSize = len(cacheMagic) + sha256.Size
+	cacheTempPrefix = ".tmp-"
 )
 
-// init 函数会在包被导入时自动执行
-func init() {
-	if !cacheEnabled {
-		return
+// DiskCache 有容量上限的磁盘缓存，超出上限时按最近最少使用淘汰
+//
+// 索引保存在内存中，启动时扫描缓存目录重建，文件修改时间作为最近访问时间
+type DiskCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	size    int64
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+	corrupted atomic.Int64
+}
+
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+// CacheStats 缓存的容量和命中统计
+type CacheStats struct {
+	Enabled   bool
+	Dir       string
+	Entries   int
+	Bytes     int64
+	MaxBytes  int64
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Corrupted int64
+}
+
+// diskCache 为空时缓存处于禁用状态
+var diskCache *DiskCache
+
+// InitCache 初始化内存缓存和磁盘缓存
+//
+// 磁盘缓存目录由 CACHE_DIR 指定，容量由 CACHE_MAX_SIZE 指定（默认 1G，0 表示禁用）
+func InitCache() error {
+	InitMemoryCache()
+
+	maxBytes := ByteSizeFromEnv("CACHE_MAX_SIZE", defaultCacheMaxSize)
+	if maxBytes <= 0 {
+		log.Printf("Disk image cache disabled")
+		return nil
+	}
+	dir := os.Getenv("CACHE_DIR")
+	if dir == "" {
+		dir = defaultCacheDir
+	}
+
+	cache, err := NewDiskCache(dir, maxBytes)
+	if err != nil {
+		return err
+	}
+	diskCache = cache
+	return nil
+}
+
+// NewDiskCache 创建磁盘缓存并加载目录中已有的文件
+func NewDiskCache(dir string, maxBytes int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %v", err)
 	}
-	// 确保缓存目录存在
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		fmt.Printf("Failed to create cache directory: %v\n", err)
+	c := &DiskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
 	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
-// InitCache 显式初始化缓存目录
-func InitCache() error {
-	if !cacheEnabled {
+// load 扫描缓存目录，清理上次写入中断留下的临时文件
+func (c *DiskCache) load() error {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %v", err)
+	}
+
+	type item struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var items []item
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(file.Name(), cacheTempPrefix) {
+			os.Remove(filepath.Join(c.dir, file.Name()))
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		items = append(items, item{key: file.Name(), size: info.Size(), modTime: info.ModTime()})
+	}
+
+	// 最近访问的放在链表前面
+	sort.Slice(items, func(i, j int) bool { return items[i].modTime.After(items[j].modTime) })
+	c.mu.Lock()
+	for _, it := range items {
+		c.entries[it.key] = c.lru.PushBack(&cacheEntry{key: it.key, size: it.size})
+		c.size += it.size
+	}
+	victims := c.evict()
+	c.mu.Unlock()
+	c.remove(victims)
+	return nil
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.dir, filepath.Base(key))
+}
+
+// evict 淘汰最久未访问的条目直到不超过容量上限，返回需要删除的文件，调用方需持有锁
+func (c *DiskCache) evict() []string {
+	var victims []string
+	for c.size > c.maxBytes {
+		back := c.lru.Back()
+		if back == nil {
+			break
+		}
+		entry := back.Value.(*cacheEntry)
+		c.lru.Remove(back)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		victims = append(victims, entry.key)
+		c.evictions.Add(1)
+	}
+	return victims
+}
+
+func (c *DiskCache) remove(keys []string) {
+	for _, key := range keys {
+		os.Remove(c.path(key))
+	}
+}
+
+// forget 从索引中移除条目，调用方需持有锁
+func (c *DiskCache) forget(key string) {
+	if elem, ok := c.entries[key]; ok {
+		c.size -= elem.Value.(*cacheEntry).size
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// Contains 判断条目是否存在，不影响命中统计和访问顺序
+func (c *DiskCache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[key]
+	return ok
+}
+
+// Get 读取条目并校验数据完整性，校验失败的文件会被删除并按未命中处理
+func (c *DiskCache) Get(key string) ([]byte, error) {
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if !ok {
+		c.misses.Add(1)
+		return nil, os.ErrNotExist
+	}
+
+	path := c.path(key)
+	raw, err := os.ReadFile(path)
+	if err == nil {
+		var data []byte
+		if data, err = decodeCacheFile(raw); err == nil {
+			c.hits.Add(1)
+			now := time.Now()
+			os.Chtimes(path, now, now)
+			return data, nil
+		}
+		c.corrupted.Add(1)
+		log.Printf("Removing corrupted cache file %s: %v", key, err)
+	}
+
+	c.mu.Lock()
+	c.forget(key)
+	c.mu.Unlock()
+	os.Remove(path)
+	c.misses.Add(1)
+	return nil, err
+}
+
+// Put 通过临时文件加重命名原子地写入条目，超过容量上限的数据不会被缓存
+func (c *DiskCache) Put(key string, data []byte) error {
+	size := int64(cacheHeaderSize + len(data))
+	if size > c.maxBytes {
 		return nil
 	}
-	if err := os.MkdirAll(cacheDir, 0755); err != nil {
-		return fmt.Errorf("failed to create cache directory: %v", err)
+
+	tmp, err := os.CreateTemp(c.dir, cacheTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	_, err = tmp.Write(append([]byte(cacheMagic), sum[:]...))
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
 	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	c.forget(key)
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, size: size})
+	c.size += size
+	victims := c.evict()
+	c.mu.Unlock()
+	c.remove(victims)
 	return nil
 }
 
+// Delete 删除 key 对应的条目，以及所有以 prefix 开头的条目（prefix 为空时忽略）
+func (c *DiskCache) Delete(key, prefix string) error {
+	var keys []string
+	c.mu.Lock()
+	for k := range c.entries {
+		if k == key || (prefix != "" && strings.HasPrefix(k, prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range keys {
+		c.forget(k)
+	}
+	c.mu.Unlock()
+	c.remove(keys)
+	return nil
+}
+
+// Flush 清空缓存，返回删除的条目数
+func (c *DiskCache) Flush() int {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+	c.mu.Unlock()
+	c.remove(keys)
+	return len(keys)
+}
+
+// Stats 返回当前的容量和命中统计
+func (c *DiskCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Enabled:   true,
+		Dir:       c.dir,
+		Entries:   len(c.entries),
+		Bytes:     c.size,
+		MaxBytes:  c.maxBytes,
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Corrupted: c.corrupted.Load(),
+	}
+}
+
+// decodeCacheFile 校验文件头中的校验和，返回图片数据
+func decodeCacheFile(raw []byte) ([]byte, error) {
+	if len(raw) < cacheHeaderSize || string(raw[:len(cacheMagic)]) != cacheMagic {
+		return nil, fmt.Errorf("invalid cache file header")
+	}
+	data := raw[cacheHeaderSize:]
+	sum := sha256.Sum256(data)
+	if !bytes.Equal(sum[:], raw[len(cacheMagic):cacheHeaderSize]) {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+	return data, nil
+}
+
+func imageCacheKey(hash string) string {
+	return hash + ".webp"
+}
+
+// loadCached 先查内存缓存，再查磁盘缓存，磁盘命中时提升到内存
+func loadCached(key string) ([]byte, error) {
+	if memoryCache != nil {
+		if data, ok := memoryCache.Get(key); ok {
+			return data, nil
+		}
+	}
+	if diskCache == nil {
+		return nil, fmt.Errorf("cache is disabled")
+	}
+	data, err := diskCache.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if memoryCache != nil {
+		memoryCache.Put(key, data)
+	}
+	return data, nil
+}
+
+// saveCached 同时写入内存缓存和磁盘缓存
+func saveCached(key string, data []byte) error {
+	if memoryCache != nil {
+		memoryCache.Put(key, data)
+	}
+	if diskCache == nil {
+		return nil
+	}
+	return diskCache.Put(key, data)
+}
+
 func ImageExistsInCache(hash string) bool {
-	if !cacheEnabled {
+	if diskCache == nil {
 		return false
 	}
-	_, err := os.Stat(filepath.Join(cacheDir, hash+".webp"))
-	return err == nil
+	return diskCache.Contains(imageCacheKey(hash))
 }
 
 func SaveImageToCache(hash string, data []byte) error {
-	if !cacheEnabled {
-		return nil
-	}
-	return ioutil.WriteFile(filepath.Join(cacheDir, hash+".webp"), data, 0644)
+	return saveCached(imageCacheKey(hash), data)
 }
 
 func LoadImageFromCache(hash string) ([]byte, error) {
-	if !cacheEnabled {
-		return nil, fmt.Errorf("cache is disabled")
-	}
-	return ioutil.ReadFile(filepath.Join(cacheDir, hash+".webp"))
+	return loadCached(imageCacheKey(hash))
 }
 
+// DeleteImageFromCache 从所有缓存层中删除图片及其所有变体
 func DeleteImageFromCache(hash string) error {
-	if !cacheEnabled {
+	if memoryCache != nil {
+		memoryCache.Delete(imageCacheKey(hash), hash+"_")
+	}
+	if diskCache == nil {
 		return nil
 	}
-	return os.Remove(filepath.Join(cacheDir, hash+".webp"))
+	return diskCache.Delete(imageCacheKey(hash), hash+"_")
+}
+
+// SaveVariantToCache 保存缩放/转码后的图片，key 由 TransformOptions.CacheKey 生成
+func SaveVariantToCache(key string, data []byte) error {
+	return saveCached(filepath.Base(key), data)
+}
+
+func LoadVariantFromCache(key string) ([]byte, error) {
+	return loadCached(filepath.Base(key))
+}
+
+// DiskCacheStats 返回磁盘缓存的统计信息，禁用时 Enabled 为 false
+func DiskCacheStats() CacheStats {
+	if diskCache == nil {
+		return CacheStats{}
+	}
+	return diskCache.Stats()
+}
+
+// FlushDiskCache 清空磁盘缓存，返回删除的文件数
+func FlushDiskCache() int {
+	if diskCache == nil {
+		return 0
+	}
+	return diskCache.Flush()
 }
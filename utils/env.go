@@ -3,6 +3,9 @@ package utils
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -20,7 +23,7 @@ func CheckRequiredEnvVars() error {
 	}
 
 	// 如果启用了 Minio，检查 Minio 相关的环境变量
-	if os.Getenv("USE_MINIO_STORAGE") == "true" {
+	if os.Getenv("USE_MINIO_STORAGE") == "true" || os.Getenv("IMAGE_STORAGE") == "s3" {
 		required = append(required,
 			"MINIO_ENDPOINT",
 			"MINIO_ACCESS_KEY",
@@ -42,3 +45,65 @@ func CheckRequiredEnvVars() error {
 
 	return nil
 }
+
+// ParseByteSize 解析字节数，支持 K/M/G 后缀（按 1024 计算），如 "20MB"、"512K"
+func ParseByteSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(s, "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+	return n * multiplier, nil
+}
+
+// ByteSizeFromEnv 读取以字节数表示的环境变量，未设置或格式错误时返回默认值
+func ByteSizeFromEnv(key string, fallback int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := ParseByteSize(value)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+// ParseDuration 在 time.ParseDuration 的基础上支持以天为单位的 "d" 后缀，如 "30d"
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration: %s", value)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// DurationFromEnv 读取表示时长的环境变量，未设置或格式错误时返回默认值
+func DurationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := ParseDuration(value)
+	if err != nil || d < 0 {
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"strings"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// EXIF 标签
+const (
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagCopyright        = 0x8298
+	exifTagExifIFD          = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+)
+
+// ExifInfo 从 EXIF 中读取的少量字段，其余信息（包括 GPS、相机型号）不会被解析或保留
+type ExifInfo struct {
+	// Orientation 取值 1-8，0 表示没有方向信息
+	Orientation int
+	// CaptureDate 拍摄时间，EXIF 中没有时区信息，按 UTC 处理
+	CaptureDate time.Time
+	Copyright   string
+}
+
+// ReadExif 从 JPEG、PNG、WebP 中读取 EXIF，没有或无法解析时返回零值
+func ReadExif(buffer []byte) ExifInfo {
+	tiff := findExifBlock(buffer)
+	if tiff == nil {
+		return ExifInfo{}
+	}
+	return parseTIFF(tiff)
+}
+
+// findExifBlock 返回 TIFF 格式的 EXIF 数据块
+func findExifBlock(buffer []byte) []byte {
+	switch {
+	case len(buffer) > 4 && buffer[0] == 0xFF && buffer[1] == 0xD8:
+		return jpegExif(buffer)
+	case len(buffer) > 8 && bytes.Equal(buffer[:8], []byte("\x89PNG\r\n\x1a\n")):
+		return pngExif(buffer)
+	case len(buffer) > 12 && string(buffer[:4]) == "RIFF" && string(buffer[8:12]) == "WEBP":
+		for _, chunk := range webpChunks(buffer) {
+			if chunk.fourCC == "EXIF" {
+				return bytes.TrimPrefix(chunk.payload, []byte("Exif\x00\x00"))
+			}
+		}
+	}
+	return nil
+}
+
+func jpegExif(buffer []byte) []byte {
+	pos := 2
+	for pos+4 <= len(buffer) {
+		if buffer[pos] != 0xFF {
+			return nil
+		}
+		marker := buffer[pos+1]
+		// 图像数据开始后不会再有 EXIF
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(buffer[pos+2:]))
+		if length < 2 || pos+2+length > len(buffer) {
+			return nil
+		}
+		segment := buffer[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		pos += 2 + length
+	}
+	return nil
+}
+
+func pngExif(buffer []byte) []byte {
+	pos := 8
+	for pos+8 <= len(buffer) {
+		length := int(binary.BigEndian.Uint32(buffer[pos:]))
+		kind := string(buffer[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(buffer) {
+			return nil
+		}
+		if kind == "eXIf" {
+			return buffer[pos+8 : pos+8+length]
+		}
+		if kind == "IDAT" || kind == "IEND" {
+			return nil
+		}
+		pos += 12 + length
+	}
+	return nil
+}
+
+func parseTIFF(tiff []byte) ExifInfo {
+	var info ExifInfo
+	if len(tiff) < 8 {
+		return info
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return info
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return info
+	}
+
+	var dateTime, dateTimeOriginal string
+	var exifIFD uint32
+	readIFD := func(offset uint32, fn func(tag, kind uint16, count uint32, value []byte)) {
+		if int(offset)+2 > len(tiff) {
+			return
+		}
+		entries := int(order.Uint16(tiff[offset:]))
+		for i := 0; i < entries; i++ {
+			pos := int(offset) + 2 + i*12
+			if pos+12 > len(tiff) {
+				return
+			}
+			fn(order.Uint16(tiff[pos:]), order.Uint16(tiff[pos+2:]), order.Uint32(tiff[pos+4:]), tiff[pos+8:pos+12])
+		}
+	}
+	readString := func(count uint32, value []byte) string {
+		data := value
+		if count > 4 {
+			offset := order.Uint32(value)
+			if uint64(offset)+uint64(count) > uint64(len(tiff)) {
+				return ""
+			}
+			data = tiff[offset : offset+count]
+		} else {
+			data = value[:count]
+		}
+		return strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+	}
+
+	readIFD(order.Uint32(tiff[4:]), func(tag, kind uint16, count uint32, value []byte) {
+		switch tag {
+		case exifTagOrientation:
+			if kind == 3 {
+				info.Orientation = int(order.Uint16(value))
+			}
+		case exifTagDateTime:
+			if kind == 2 {
+				dateTime = readString(count, value)
+			}
+		case exifTagCopyright:
+			if kind == 2 {
+				info.Copyright = readString(count, value)
+			}
+		case exifTagExifIFD:
+			exifIFD = order.Uint32(value)
+		}
+	})
+	if exifIFD != 0 {
+		readIFD(exifIFD, func(tag, kind uint16, count uint32, value []byte) {
+			if tag == exifTagDateTimeOriginal && kind == 2 {
+				dateTimeOriginal = readString(count, value)
+			}
+		})
+	}
+
+	if info.Orientation < 1 || info.Orientation > 8 {
+		info.Orientation = 0
+	}
+	for _, value := range []string{dateTimeOriginal, dateTime} {
+		if t, err := time.Parse("2006:01:02 15:04:05", value); err == nil {
+			info.CaptureDate = t
+			break
+		}
+	}
+	return info
+}
+
+// DecodeImage 解码图片并按 EXIF 方向信息旋转，动图只解码第一帧
+func DecodeImage(buffer []byte) (image.Image, string, error) {
+	data := buffer
+	if _, animated := DetectAnimation(buffer); animated && isWebP(buffer) {
+		frame, err := firstWebPFrame(buffer)
+		if err != nil {
+			return nil, "", err
+		}
+		data = frame
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	return ApplyOrientation(img, ReadExif(buffer).Orientation), format, nil
+}
+
+// ApplyOrientation 按 EXIF 方向值（1-8）旋转或翻转图片
+func ApplyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	src := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // 水平翻转
+				dx, dy = w-1-x, y
+			case 3: // 旋转 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				dx, dy = x, h-1-y
+			case 5: // 沿主对角线翻转
+				dx, dy = y, x
+			case 6: // 顺时针旋转 90°
+				dx, dy = h-1-y, x
+			case 7: // 沿副对角线翻转
+				dx, dy = h-1-y, w-1-x
+			case 8: // 逆时针旋转 90°
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+type webpChunk struct {
+	fourCC  string
+	payload []byte
+}
+
+// webpChunks 拆分 WebP（RIFF）容器中的数据块
+func webpChunks(buffer []byte) []webpChunk {
+	var chunks []webpChunk
+	pos := 12
+	for pos+8 <= len(buffer) {
+		size := int(binary.LittleEndian.Uint32(buffer[pos+4:]))
+		if size < 0 || pos+8+size > len(buffer) {
+			break
+		}
+		chunks = append(chunks, webpChunk{fourCC: string(buffer[pos : pos+4]), payload: buffer[pos+8 : pos+8+size]})
+		pos += 8 + size + size%2
+	}
+	return chunks
+}
+
+// StripWebPMetadata 移除 WebP 中的 EXIF 和 XMP 数据块，不重新编码图片
+//
+// keepICC 为 true 时保留 ICC 色彩配置
+func StripWebPMetadata(buffer []byte, keepICC bool) []byte {
+	if len(buffer) < 12 || string(buffer[:4]) != "RIFF" || string(buffer[8:12]) != "WEBP" {
+		return buffer
+	}
+	chunks := webpChunks(buffer)
+	// 简单格式（没有 VP8X）的 WebP 不包含元数据
+	if len(chunks) == 0 || chunks[0].fourCC != "VP8X" || len(chunks[0].payload) < 1 {
+		return buffer
+	}
+
+	const (
+		flagICC  = 0x20
+		flagEXIF = 0x08
+		flagXMP  = 0x04
+	)
+	var out bytes.Buffer
+	out.Write([]byte("RIFF\x00\x00\x00\x00WEBP"))
+	for _, chunk := range chunks {
+		payload := chunk.payload
+		switch chunk.fourCC {
+		case "EXIF", "XMP ":
+			continue
+		case "ICCP":
+			if !keepICC {
+				continue
+			}
+		case "VP8X":
+			payload = append([]byte(nil), payload...)
+			payload[0] &^= flagEXIF | flagXMP
+			if !keepICC {
+				payload[0] &^= flagICC
+			}
+		}
+		var header [8]byte
+		copy(header[:4], chunk.fourCC)
+		binary.LittleEndian.PutUint32(header[4:], uint32(len(payload)))
+		out.Write(header[:])
+		out.Write(payload)
+		if len(payload)%2 == 1 {
+			out.WriteByte(0)
+		}
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result
+}
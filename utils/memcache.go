@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultMemoryCacheSize = 64 << 20
+
+// MemoryCache 有字节预算的内存缓存，位于磁盘缓存之上，用于访问频繁的图片
+type MemoryCache struct {
+	maxBytes int64
+	// maxObject 单个对象的大小上限，避免一张大图挤掉大量小图
+	maxObject int64
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	size    int64
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+type memoryEntry struct {
+	key  string
+	data []byte
+}
+
+// memoryCache 为空时内存缓存处于禁用状态
+var memoryCache *MemoryCache
+
+// InitMemoryCache 初始化内存缓存，容量由 MEMORY_CACHE_SIZE 指定（默认 64M，0 表示禁用）
+func InitMemoryCache() {
+	maxBytes := ByteSizeFromEnv("MEMORY_CACHE_SIZE", defaultMemoryCacheSize)
+	if maxBytes <= 0 {
+		memoryCache = nil
+		return
+	}
+	memoryCache = NewMemoryCache(maxBytes)
+}
+
+// NewMemoryCache 创建内存缓存，单个对象最多占用容量的 1/8
+func NewMemoryCache(maxBytes int64) *MemoryCache {
+	return &MemoryCache{
+		maxBytes:  maxBytes,
+		maxObject: maxBytes / 8,
+		lru:       list.New(),
+		entries:   make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	c.hits.Add(1)
+	return elem.Value.(*memoryEntry).data, true
+}
+
+func (c *MemoryCache) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[key]
+	return ok
+}
+
+// Put 保存对象，调用方之后不能再修改 data
+func (c *MemoryCache) Put(key string, data []byte) {
+	if int64(len(data)) > c.maxObject {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forget(key)
+	c.entries[key] = c.lru.PushFront(&memoryEntry{key: key, data: data})
+	c.size += int64(len(data))
+	for c.size > c.maxBytes {
+		back := c.lru.Back()
+		if back == nil {
+			break
+		}
+		c.forget(back.Value.(*memoryEntry).key)
+		c.evictions.Add(1)
+	}
+}
+
+// forget 从缓存中移除对象，调用方需持有锁
+func (c *MemoryCache) forget(key string) {
+	if elem, ok := c.entries[key]; ok {
+		c.size -= int64(len(elem.Value.(*memoryEntry).data))
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// Delete 删除 key 对应的对象，以及所有以 prefix 开头的对象（prefix 为空时忽略）
+func (c *MemoryCache) Delete(key, prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if k == key || (prefix != "" && strings.HasPrefix(k, prefix)) {
+			c.forget(k)
+		}
+	}
+}
+
+// Flush 清空缓存，返回删除的对象数
+func (c *MemoryCache) Flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := len(c.entries)
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+	return n
+}
+
+func (c *MemoryCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Enabled:   true,
+		Entries:   len(c.entries),
+		Bytes:     c.size,
+		MaxBytes:  c.maxBytes,
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+	}
+}
+
+// MemoryCacheStats 返回内存缓存的统计信息，禁用时 Enabled 为 false
+func MemoryCacheStats() CacheStats {
+	if memoryCache == nil {
+		return CacheStats{}
+	}
+	return memoryCache.Stats()
+}
+
+// FlushMemoryCache 清空内存缓存，返回删除的对象数
+func FlushMemoryCache() int {
+	if memoryCache == nil {
+		return 0
+	}
+	return memoryCache.Flush()
+}
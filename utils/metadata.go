@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// ImageInfo 上传时从图片中提取的信息
+type ImageInfo struct {
+	Width         int
+	Height        int
+	Format        string
+	DominantColor string
+	BlurHash      string
+	PHash         string
+}
+
+// AnalyzeImage 解码图片并提取尺寸、主色调、BlurHash 占位图和感知哈希，尺寸按 EXIF 方向旋转后计算
+func AnalyzeImage(buffer []byte) (ImageInfo, error) {
+	img, format, err := DecodeImage(buffer)
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("decode failed: %v", err)
+	}
+	return AnalyzeDecodedImage(img, format), nil
+}
+
+// AnalyzeDecodedImage 从已解码的图片中提取信息
+func AnalyzeDecodedImage(img image.Image, format string) ImageInfo {
+	bounds := img.Bounds()
+	info := ImageInfo{
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Format: format,
+	}
+	if info.Width == 0 || info.Height == 0 {
+		return info
+	}
+
+	// 在缩略图上计算，避免大图耗时过长
+	thumb := resizeImage(img, 64, 64, FitContain)
+	info.DominantColor = dominantColor(thumb)
+	info.BlurHash = EncodeBlurHash(resizeImage(img, 32, 32, FitContain), 4, 3)
+	info.PHash = FormatPHash(DHash(img))
+	return info
+}
+
+// dominantColor 将颜色量化到 4096 个区间，返回像素最多的区间的平均色
+func dominantColor(img image.Image) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	var best *bucket
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			// 忽略几乎透明的像素
+			if c.A < 128 {
+				continue
+			}
+			key := int(c.R>>4)<<8 | int(c.G>>4)<<4 | int(c.B>>4)
+			bk, ok := buckets[key]
+			if !ok {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.count++
+			bk.r += int(c.R)
+			bk.g += int(c.G)
+			bk.b += int(c.B)
+			if best == nil || bk.count > best.count {
+				best = bk
+			}
+		}
+	}
+
+	if best == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
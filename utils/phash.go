@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+)
+
+// DHash 计算 64 位差异哈希（dHash）
+//
+// 图片缩小到 9x8 灰度后比较相邻像素的亮度，重新编码或缩放后的同一张图片哈希值相同或非常接近
+func DHash(img image.Image) uint64 {
+	small := resizeImage(img, 9, 8, FitFill)
+	bounds := small.Bounds()
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		left := luminance(small, bounds.Min.X, bounds.Min.Y+y)
+		for x := 1; x < 9; x++ {
+			right := luminance(small, bounds.Min.X+x, bounds.Min.Y+y)
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+			left = right
+		}
+	}
+	return hash
+}
+
+func luminance(img image.Image, x, y int) uint32 {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return (299*r + 587*g + 114*b) / 1000
+}
+
+// FormatPHash 将哈希格式化为 16 位十六进制字符串
+func FormatPHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// ParsePHash 解析 FormatPHash 生成的字符串
+func ParsePHash(value string) (uint64, error) {
+	return strconv.ParseUint(value, 16, 64)
+}
+
+// HammingDistance 返回两个哈希之间不同的位数
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
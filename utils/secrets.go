@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretEnvVars 值需要保密的环境变量，名称以 _TOKEN、_KEY、_SECRET、_PASSWORD 结尾的变量同样视为机密
+var secretEnvVars = map[string]bool{
+	"TOKEN":                true,
+	"ADMIN_TOKEN":          true,
+	"MONGODB_URI":          true,
+	"MINIO_ACCESS_KEY":     true,
+	"MINIO_SECRET_KEY":     true,
+	"STEAM_API_KEY":        true,
+	"IPINFO_TOKEN":         true,
+	"CLOUDFLARE_API_TOKEN": true,
+	"GITHUB_TOKEN":         true,
+}
+
+// 过短的值替换后会破坏日志内容，也不太可能是真正的密钥
+const minSecretLength = 4
+
+// IsSecretEnv 判断环境变量的值是否需要保密
+func IsSecretEnv(name string) bool {
+	if secretEnvVars[name] {
+		return true
+	}
+	for _, suffix := range []string{"_TOKEN", "_KEY", "_SECRET", "_PASSWORD"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretValues 返回当前设置的所有机密值，连接地址中的密码单独列出
+func secretValues() []string {
+	var values []string
+	for _, env := range os.Environ() {
+		name, value, ok := strings.Cut(env, "=")
+		if !ok || !IsSecretEnv(name) || len(value) < minSecretLength {
+			continue
+		}
+		values = append(values, value)
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			if password, ok := u.User.Password(); ok && len(password) >= minSecretLength {
+				values = append(values, password)
+			}
+		}
+	}
+	return values
+}
+
+// Redact 将文本中出现的机密值替换为 [REDACTED]
+func Redact(s string) string {
+	for _, value := range secretValues() {
+		if strings.Contains(s, value) {
+			s = strings.ReplaceAll(s, value, redacted)
+		}
+	}
+	return s
+}
+
+// RedactedEnv 返回可以输出到日志的环境变量值，机密变量只显示是否设置，连接地址隐藏密码
+func RedactedEnv(name string) string {
+	value := os.Getenv(name)
+	switch {
+	case value == "":
+		return "[Not Set]"
+	case !IsSecretEnv(name):
+		return value
+	}
+	if u, err := url.Parse(value); err == nil && u.Scheme != "" && u.Host != "" {
+		u.RawQuery = ""
+		if u.User != nil {
+			u.User = url.User(u.User.Username())
+		}
+		return u.String()
+	}
+	return "[Set]"
+}
+
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := r.w.Write([]byte(Redact(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// NewRedactingWriter 返回写入前替换机密值的 Writer，用于日志输出
+func NewRedactingWriter(w io.Writer) io.Writer {
+	return redactingWriter{w: w}
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"pysio.online/blog_api/internal/testutil"
+)
+
+func TestIsSecretEnv(t *testing.T) {
+	for name, want := range map[string]bool{
+		"TOKEN":             true,
+		"ADMIN_TOKEN":       true,
+		"MONGODB_URI":       true,
+		"STEAM_API_KEY":     true,
+		"CUSTOM_SECRET":     true,
+		"SMTP_PASSWORD":     true,
+		"STEAM_ID":          false,
+		"MONGODB_DB_NAME":   false,
+		"TOKEN_EXPIRY_DAYS": false,
+	} {
+		if got := IsSecretEnv(name); got != want {
+			t.Errorf("IsSecretEnv(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	testutil.SetSecrets(t)
+
+	input := "GET https://api.example.com/?key=" + testutil.SteamAPIKey + "&token=" + testutil.AdminToken + " " +
+		testutil.Token + " " + testutil.CustomSecret + " dial " + testutil.MongoPassword + " failed"
+	got := Redact(input)
+	testutil.AssertNoSecrets(t, "Redact output", got)
+	if !strings.Contains(got, "key="+redacted) || !strings.Contains(got, "dial "+redacted+" failed") {
+		t.Errorf("Redact output = %q, want secrets replaced by %s", got, redacted)
+	}
+}
+
+func TestRedactIgnoresShortValues(t *testing.T) {
+	t.Setenv("SHORT_TOKEN", "abc")
+	if got := Redact("abcdef"); got != "abcdef" {
+		t.Errorf("Redact(%q) = %q, short values should not be replaced", "abcdef", got)
+	}
+}
+
+func TestRedactedEnv(t *testing.T) {
+	testutil.SetSecrets(t)
+	t.Setenv("STEAM_ID", "76561198000000000")
+	t.Setenv("EMPTY_TOKEN", "")
+
+	tests := map[string]string{
+		"STEAM_ID":      "76561198000000000",
+		"EMPTY_TOKEN":   "[Not Set]",
+		"ADMIN_TOKEN":   "[Set]",
+		"STEAM_API_KEY": "[Set]",
+		"MONGODB_URI":   "mongodb://user@localhost:27017/db",
+	}
+	for name, want := range tests {
+		if got := RedactedEnv(name); got != want {
+			t.Errorf("RedactedEnv(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNewRedactingWriter(t *testing.T) {
+	testutil.SetSecrets(t)
+
+	var buf bytes.Buffer
+	w := NewRedactingWriter(&buf)
+	line := []byte("token " + testutil.AdminToken + " rejected\n")
+	n, err := w.Write(line)
+	if err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	// 返回原始长度，调用方不会认为写入不完整
+	if n != len(line) {
+		t.Errorf("Write returned %d, want %d", n, len(line))
+	}
+	if got, want := buf.String(), "token "+redacted+" rejected\n"; got != want {
+		t.Errorf("written = %q, want %q", got, want)
+	}
+}
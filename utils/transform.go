@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// 输出格式
+const (
+	FormatWebP = "webp"
+	FormatAVIF = "avif"
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+)
+
+// 缩放方式
+const (
+	FitContain = "contain" // 等比缩放到目标尺寸以内，不放大
+	FitCover   = "cover"   // 等比缩放后居中裁剪，填满目标尺寸
+	FitFill    = "fill"    // 拉伸到目标尺寸
+)
+
+const (
+	maxTransformDimension = 4096
+	defaultQuality        = 80
+)
+
+// TransformOptions 图片变换参数
+type TransformOptions struct {
+	Width   int
+	Height  int
+	Fit     string
+	Quality int
+	// Format 为空时表示根据 Accept 请求头协商
+	Format string
+}
+
+// ParseTransformOptions 解析 w/h/fit/q/format 查询参数
+func ParseTransformOptions(width, height, fit, quality, format string) (TransformOptions, error) {
+	var opts TransformOptions
+	var err error
+
+	if width != "" {
+		if opts.Width, err = strconv.Atoi(width); err != nil || opts.Width <= 0 || opts.Width > maxTransformDimension {
+			return opts, fmt.Errorf("invalid width: must be between 1 and %d", maxTransformDimension)
+		}
+	}
+	if height != "" {
+		if opts.Height, err = strconv.Atoi(height); err != nil || opts.Height <= 0 || opts.Height > maxTransformDimension {
+			return opts, fmt.Errorf("invalid height: must be between 1 and %d", maxTransformDimension)
+		}
+	}
+	if quality != "" {
+		if opts.Quality, err = strconv.Atoi(quality); err != nil || opts.Quality < 1 || opts.Quality > 100 {
+			return opts, fmt.Errorf("invalid quality: must be between 1 and 100")
+		}
+	}
+
+	switch fit = strings.ToLower(fit); fit {
+	case "", FitContain, FitCover, FitFill:
+		opts.Fit = fit
+	case "inside":
+		opts.Fit = FitContain
+	default:
+		return opts, fmt.Errorf("invalid fit: %s", fit)
+	}
+
+	switch format = strings.ToLower(format); format {
+	case "", "auto":
+	case "jpg", FormatJPEG:
+		opts.Format = FormatJPEG
+	case FormatWebP, FormatPNG:
+		opts.Format = format
+	case FormatAVIF:
+		if !AVIFSupported() {
+			return opts, fmt.Errorf("avif output is not available on this server")
+		}
+		opts.Format = format
+	default:
+		return opts, fmt.Errorf("unsupported format: %s", format)
+	}
+
+	return opts, nil
+}
+
+// IsZero 判断是否未指定任何变换参数
+func (o TransformOptions) IsZero() bool {
+	return o == TransformOptions{}
+}
+
+// ClampTo 把目标尺寸限制在原图尺寸以内，避免放大生成比原图更大的变体；同时指定宽高时保持目标比例
+func (o TransformOptions) ClampTo(width, height int) TransformOptions {
+	if width <= 0 || height <= 0 {
+		return o
+	}
+	switch {
+	case o.Width > 0 && o.Height > 0:
+		if o.Width <= width && o.Height <= height {
+			return o
+		}
+		if o.Width*height > o.Height*width {
+			o.Height = max(1, o.Height*width/o.Width)
+			o.Width = width
+		} else {
+			o.Width = max(1, o.Width*height/o.Height)
+			o.Height = height
+		}
+	case o.Width > width:
+		o.Width = width
+	case o.Height > height:
+		o.Height = height
+	}
+	return o
+}
+
+// CacheKey 返回变换结果在缓存中的键，需在确定输出格式后调用
+func (o TransformOptions) CacheKey(hash string) string {
+	return fmt.Sprintf("%s_w%d_h%d_%s_q%d.%s", hash, o.Width, o.Height, o.fit(), o.quality(), o.Format)
+}
+
+func (o TransformOptions) fit() string {
+	if o.Fit == "" {
+		return FitContain
+	}
+	return o.Fit
+}
+
+func (o TransformOptions) quality() int {
+	if o.Quality == 0 {
+		return defaultQuality
+	}
+	return o.Quality
+}
+
+// AVIFSupported 判断系统是否安装了 avifenc
+func AVIFSupported() bool {
+	_, err := exec.LookPath("avifenc")
+	return err == nil
+}
+
+// NegotiateFormat 根据 Accept 请求头选择输出格式，优先 AVIF、WebP，都不支持时使用 JPEG
+func NegotiateFormat(accept string) string {
+	accept = strings.ToLower(accept)
+	if strings.Contains(accept, "image/avif") && AVIFSupported() {
+		return FormatAVIF
+	}
+	if strings.Contains(accept, "image/webp") {
+		return FormatWebP
+	}
+	return FormatJPEG
+}
+
+// ContentTypeForFormat 返回输出格式对应的 MIME 类型
+func ContentTypeForFormat(format string) string {
+	switch format {
+	case FormatAVIF:
+		return "image/avif"
+	case FormatJPEG:
+		return "image/jpeg"
+	case FormatPNG:
+		return "image/png"
+	default:
+		return "image/webp"
+	}
+}
+
+// TransformImage 按参数缩放图片并编码为 opts.Format 指定的格式
+func TransformImage(buffer []byte, opts TransformOptions) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(buffer))
+	if err != nil {
+		return nil, fmt.Errorf("decode failed: %v", err)
+	}
+
+	bounds := src.Bounds()
+	opts = opts.ClampTo(bounds.Dx(), bounds.Dy())
+	dst := resizeImage(src, opts.Width, opts.Height, opts.fit())
+
+	var out bytes.Buffer
+	switch opts.Format {
+	case FormatJPEG:
+		err = jpeg.Encode(&out, flattenImage(dst), &jpeg.Options{Quality: opts.quality()})
+	case FormatPNG:
+		err = png.Encode(&out, dst)
+	case FormatWebP:
+		return NewWebPEncoder().EncodeImage(dst, WebPOptions{Quality: opts.quality(), StripMetadata: true})
+	case FormatAVIF:
+		return encodeAVIF(dst, opts.quality())
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", opts.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encode %s failed: %v", opts.Format, err)
+	}
+	return out.Bytes(), nil
+}
+
+// flattenImage 将透明区域合成到白色背景上，用于不支持透明通道的 JPEG
+func flattenImage(img image.Image) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
+
+// resizeImage 按缩放方式计算目标尺寸并缩放
+func resizeImage(src image.Image, width, height int, fit string) image.Image {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	if (width == 0 && height == 0) || sw == 0 || sh == 0 {
+		return src
+	}
+
+	// 只指定一边时按原图比例计算另一边
+	if width == 0 {
+		width = max(1, sw*height/sh)
+	}
+	if height == 0 {
+		height = max(1, sh*width/sw)
+	}
+
+	srcRect := sb
+	switch fit {
+	case FitCover:
+		// 按目标比例在原图中居中裁剪
+		if sw*height > sh*width {
+			cw := sh * width / height
+			x0 := sb.Min.X + (sw-cw)/2
+			srcRect = image.Rect(x0, sb.Min.Y, x0+cw, sb.Max.Y)
+		} else {
+			ch := sw * height / width
+			y0 := sb.Min.Y + (sh-ch)/2
+			srcRect = image.Rect(sb.Min.X, y0, sb.Max.X, y0+ch)
+		}
+	case FitFill:
+	default:
+		// contain：等比缩放到目标框内，不放大
+		if sw <= width && sh <= height {
+			return src
+		}
+		if sw*height > sh*width {
+			height = max(1, sh*width/sw)
+		} else {
+			width = max(1, sw*height/sh)
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, srcRect, draw.Src, nil)
+	return dst
+}
+
+// encodeAVIF 将图片写为 PNG 临时文件后调用 avifenc 编码
+func encodeAVIF(img image.Image, quality int) ([]byte, error) {
+	tmpIn, err := os.CreateTemp("", "avif-in-*.png")
+	if err != nil {
+		return nil, fmt.Errorf("create temp in file failed: %v", err)
+	}
+	defer os.Remove(tmpIn.Name())
+	defer tmpIn.Close()
+
+	if err := png.Encode(tmpIn, img); err != nil {
+		return nil, fmt.Errorf("write tmpIn failed: %v", err)
+	}
+
+	tmpOut, err := os.CreateTemp("", "avif-out-*.avif")
+	if err != nil {
+		return nil, fmt.Errorf("create temp out file failed: %v", err)
+	}
+	defer os.Remove(tmpOut.Name())
+	tmpOut.Close()
+
+	// avifenc 的质量参数范围同样是 0-100
+	cmd := exec.Command("avifenc", "-q", strconv.Itoa(quality), tmpIn.Name(), tmpOut.Name())
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("avifenc failed: %v", err)
+	}
+
+	return os.ReadFile(tmpOut.Name())
+}
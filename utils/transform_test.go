@@ -0,0 +1,30 @@
+package utils
+
+import "testing"
+
+func TestTransformOptionsClampTo(t *testing.T) {
+	tests := []struct {
+		name                  string
+		width, height         int
+		wantWidth, wantHeight int
+	}{
+		{"within source", 320, 180, 320, 180},
+		{"width only", 4096, 0, 1000, 0},
+		{"height only", 0, 4096, 0, 500},
+		{"both keep target ratio", 4000, 1000, 1000, 250},
+		{"height is the limit", 800, 1000, 400, 500},
+		{"no size", 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		got := TransformOptions{Width: tt.width, Height: tt.height}.ClampTo(1000, 500)
+		if got.Width != tt.wantWidth || got.Height != tt.wantHeight {
+			t.Errorf("%s: ClampTo = %dx%d, want %dx%d", tt.name, got.Width, got.Height, tt.wantWidth, tt.wantHeight)
+		}
+	}
+
+	// 原图尺寸未知时不修改
+	opts := TransformOptions{Width: 4096}
+	if got := opts.ClampTo(0, 0); got != opts {
+		t.Errorf("ClampTo with unknown size = %+v", got)
+	}
+}
@@ -7,63 +7,43 @@ import (
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
-	"io"
-	"os"
-	"os/exec"
 
 	_ "golang.org/x/image/webp" // 用于解码 webp
 )
 
+// ConvertToWebp 使用默认参数将图片转换为 WebP
 func ConvertToWebp(buffer []byte) ([]byte, error) {
+	return ConvertToWebpWithOptions(buffer, DefaultWebPOptions())
+}
+
+// ConvertToWebpWithOptions 使用配置的编码器将图片转换为 WebP
+func ConvertToWebpWithOptions(buffer []byte, opts WebPOptions) ([]byte, error) {
 	// 先解码，确保图片有效
 	_, format, err := image.DecodeConfig(bytes.NewReader(buffer))
 	if err != nil {
 		return nil, fmt.Errorf("decode failed: %v", err)
 	}
 
-	// 如果已是 webp，直接返回
-	if format == "webp" {
-		return buffer, nil
-	}
-
-	// 创建临时输入文件
-	tmpIn, err := os.CreateTemp("", "input-*")
-	if err != nil {
-		return nil, fmt.Errorf("create temp in file failed: %v", err)
-	}
-	defer os.Remove(tmpIn.Name())
-	defer tmpIn.Close()
-
-	if _, err = tmpIn.Write(buffer); err != nil {
-		return nil, fmt.Errorf("write tmpIn failed: %v", err)
-	}
-
-	// 创建临时输出文件
-	tmpOut, err := os.CreateTemp("", "output-*.webp")
-	if err != nil {
-		return nil, fmt.Errorf("create temp out file failed: %v", err)
-	}
-	defer os.Remove(tmpOut.Name())
-	defer tmpOut.Close()
-
-	// 调用系统 cwebp 命令，质量默认 80
-	cmd := exec.Command("cwebp", "-q", "80", tmpIn.Name(), "-o", tmpOut.Name())
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("cwebp failed: %v", err)
+	// 编码器不会处理 EXIF 方向，需要先按方向旋转再编码
+	if ReadExif(buffer).Orientation > 1 {
+		img, _, err := DecodeImage(buffer)
+		if err != nil {
+			return nil, fmt.Errorf("decode failed: %v", err)
+		}
+		return NewWebPEncoder().EncodeImage(img, opts)
 	}
 
-	// 读取生成的 WebP
-	webpData, err := os.ReadFile(tmpOut.Name())
-	if err != nil {
-		return nil, fmt.Errorf("read tmpOut failed: %v", err)
+	// 已是 webp 且没有指定编码参数时不重新编码，但要去掉 EXIF/XMP，避免泄露拍摄位置等信息
+	if format == "webp" && !opts.Reencode {
+		return StripWebPMetadata(buffer, !opts.StripMetadata), nil
 	}
 
-	return webpData, nil
+	return NewWebPEncoder().Encode(buffer, opts)
 }
 
 func ValidateImage(buffer []byte) error {
-	r := io.LimitReader(bytes.NewReader(buffer), 20*1024*1024)
-	_, format, err := image.DecodeConfig(r)
+	// 上传大小由调用方限制，这里只读取图片头部
+	_, format, err := image.DecodeConfig(bytes.NewReader(buffer))
 	if err != nil {
 		return fmt.Errorf("invalid image: %v", err)
 	}
@@ -74,3 +54,17 @@ func ValidateImage(buffer []byte) error {
 		return fmt.Errorf("unsupported format: %s", format)
 	}
 }
+
+// CheckImagePixels 只读取图片头部，宽×高超过 maxPixels 时返回错误
+//
+// 解码时按像素分配内存，文件很小但声明了超大尺寸的图片会在解码前被拒绝
+func CheckImagePixels(buffer []byte, maxPixels int64) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(buffer))
+	if err != nil {
+		return fmt.Errorf("invalid image: %v", err)
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > maxPixels {
+		return fmt.Errorf("image too large: %dx%d exceeds the limit of %d pixels", config.Width, config.Height, maxPixels)
+	}
+	return nil
+}
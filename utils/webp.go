@@ -0,0 +1,197 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/gen2brain/webp"
+)
+
+// WebPOptions WebP 编码参数
+type WebPOptions struct {
+	// Quality 有损编码质量 1-100
+	Quality int
+	// Lossless 使用无损编码
+	Lossless bool
+	// StripMetadata 不保留 ICC 色彩配置；EXIF/XMP 无论如何都不会写入输出
+	StripMetadata bool
+	// Reencode 已是 WebP 的图片也按 Quality/Lossless 重新编码，请求中指定了 quality 或 lossless 时为 true
+	Reencode bool
+}
+
+// DefaultWebPOptions 返回上传时使用的默认编码参数
+func DefaultWebPOptions() WebPOptions {
+	return WebPOptions{Quality: defaultQuality, StripMetadata: true}
+}
+
+// ParseWebPOptions 解析请求中的 quality/lossless/strip_metadata 参数，空值使用默认值
+func ParseWebPOptions(quality, lossless, stripMetadata string) (WebPOptions, error) {
+	opts := DefaultWebPOptions()
+	var err error
+
+	if quality != "" {
+		if opts.Quality, err = strconv.Atoi(quality); err != nil || opts.Quality < 1 || opts.Quality > 100 {
+			return opts, fmt.Errorf("invalid quality: must be between 1 and 100")
+		}
+		opts.Reencode = true
+	}
+	if lossless != "" {
+		if opts.Lossless, err = strconv.ParseBool(lossless); err != nil {
+			return opts, fmt.Errorf("invalid lossless: %s", lossless)
+		}
+		opts.Reencode = true
+	}
+	if stripMetadata != "" {
+		if opts.StripMetadata, err = strconv.ParseBool(stripMetadata); err != nil {
+			return opts, fmt.Errorf("invalid strip_metadata: %s", stripMetadata)
+		}
+	}
+	return opts, nil
+}
+
+// WebPEncoder WebP 编码器
+type WebPEncoder interface {
+	Name() string
+	// Encode 将原始图片文件编码为 WebP
+	Encode(buffer []byte, opts WebPOptions) ([]byte, error)
+	// EncodeImage 将已解码的图片编码为 WebP
+	EncodeImage(img image.Image, opts WebPOptions) ([]byte, error)
+}
+
+// NewWebPEncoder 根据 WEBP_ENCODER 环境变量选择编码器，默认使用进程内编码器
+//
+// 设置 WEBP_ENCODER=cwebp 时调用外部 cwebp，可通过 CWEBP_PATH 指定路径
+func NewWebPEncoder() WebPEncoder {
+	if os.Getenv("WEBP_ENCODER") == "cwebp" {
+		path := os.Getenv("CWEBP_PATH")
+		if path == "" {
+			path = "cwebp"
+		}
+		return &CwebpEncoder{Path: path}
+	}
+	return NativeWebPEncoder{}
+}
+
+// NativeWebPEncoder 进程内编码器，不依赖外部命令
+//
+// 无损编码使用纯 Go 实现；有损编码使用编译为 WebAssembly 的 libwebp，系统中安装了 libwebp 时直接调用系统库。
+// 解码后重新编码，不会保留任何元数据
+type NativeWebPEncoder struct{}
+
+func (NativeWebPEncoder) Name() string {
+	return "native"
+}
+
+func (e NativeWebPEncoder) Encode(buffer []byte, opts WebPOptions) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(buffer))
+	if err != nil {
+		return nil, fmt.Errorf("decode failed: %v", err)
+	}
+	return e.EncodeImage(img, opts)
+}
+
+func (NativeWebPEncoder) EncodeImage(img image.Image, opts WebPOptions) ([]byte, error) {
+	var out bytes.Buffer
+	if opts.Lossless {
+		if err := nativewebp.Encode(&out, img, nil); err != nil {
+			return nil, fmt.Errorf("webp encode failed: %v", err)
+		}
+		return out.Bytes(), nil
+	}
+
+	quality := opts.Quality
+	if quality == 0 {
+		quality = defaultQuality
+	}
+	// libwebp 把 quality 100 当作无损编码，这里限制在有损范围内
+	if quality > 99 {
+		quality = 99
+	}
+	if err := webp.Encode(&out, img, webp.Options{Quality: quality, Method: webp.DefaultMethod}); err != nil {
+		return nil, fmt.Errorf("webp encode failed: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// CwebpEncoder 调用外部 cwebp 命令编码
+type CwebpEncoder struct {
+	Path string
+}
+
+func (e *CwebpEncoder) Name() string {
+	return "cwebp"
+}
+
+func (e *CwebpEncoder) Encode(buffer []byte, opts WebPOptions) ([]byte, error) {
+	// 创建临时输入文件
+	tmpIn, err := os.CreateTemp("", "input-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp in file failed: %v", err)
+	}
+	defer os.Remove(tmpIn.Name())
+	defer tmpIn.Close()
+
+	if _, err = tmpIn.Write(buffer); err != nil {
+		return nil, fmt.Errorf("write tmpIn failed: %v", err)
+	}
+
+	// 创建临时输出文件
+	tmpOut, err := os.CreateTemp("", "output-*.webp")
+	if err != nil {
+		return nil, fmt.Errorf("create temp out file failed: %v", err)
+	}
+	defer os.Remove(tmpOut.Name())
+	defer tmpOut.Close()
+
+	args := []string{}
+	if opts.Lossless {
+		args = append(args, "-lossless")
+	} else {
+		quality := opts.Quality
+		if quality == 0 {
+			quality = defaultQuality
+		}
+		args = append(args, "-q", strconv.Itoa(quality))
+	}
+	// EXIF/XMP 可能包含 GPS 位置和相机信息，最多只保留 ICC 色彩配置
+	if opts.StripMetadata {
+		args = append(args, "-metadata", "none")
+	} else {
+		args = append(args, "-metadata", "icc")
+	}
+	args = append(args, tmpIn.Name(), "-o", tmpOut.Name())
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(e.Path, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("cwebp failed: %v: %s", err, msg)
+		}
+		return nil, fmt.Errorf("cwebp failed: %v", err)
+	}
+
+	// 读取生成的 WebP
+	webpData, err := os.ReadFile(tmpOut.Name())
+	if err != nil {
+		return nil, fmt.Errorf("read tmpOut failed: %v", err)
+	}
+
+	return webpData, nil
+}
+
+func (e *CwebpEncoder) EncodeImage(img image.Image, opts WebPOptions) ([]byte, error) {
+	// 以无损 PNG 作为中间格式交给 cwebp
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode intermediate png failed: %v", err)
+	}
+	return e.Encode(buf.Bytes(), opts)
+}
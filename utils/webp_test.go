@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func testImagePNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 4), uint8(x * y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseWebPOptionsReencode(t *testing.T) {
+	tests := []struct {
+		quality, lossless string
+		want              bool
+	}{
+		{"", "", false},
+		{"50", "", true},
+		{"", "true", true},
+		{"", "false", true},
+	}
+	for _, tt := range tests {
+		opts, err := ParseWebPOptions(tt.quality, tt.lossless, "")
+		if err != nil {
+			t.Fatalf("ParseWebPOptions(%q, %q): %v", tt.quality, tt.lossless, err)
+		}
+		if opts.Reencode != tt.want {
+			t.Errorf("ParseWebPOptions(%q, %q).Reencode = %v, want %v", tt.quality, tt.lossless, opts.Reencode, tt.want)
+		}
+	}
+}
+
+func TestConvertWebPInput(t *testing.T) {
+	t.Setenv("WEBP_ENCODER", "")
+	source, err := ConvertToWebpWithOptions(testImagePNG(t), WebPOptions{Quality: 90, StripMetadata: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未指定编码参数时原样保存
+	out, err := ConvertToWebpWithOptions(source, DefaultWebPOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, source) {
+		t.Error("webp input re-encoded without explicit options")
+	}
+
+	opts, _ := ParseWebPOptions("10", "", "")
+	out, err = ConvertToWebpWithOptions(source, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(out, source) || len(out) >= len(source) {
+		t.Errorf("quality=10 output is %d bytes, source %d bytes", len(out), len(source))
+	}
+
+	opts, _ = ParseWebPOptions("", "true", "")
+	out, err = ConvertToWebpWithOptions(source, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(out, source) {
+		t.Error("lossless=true did not re-encode webp input")
+	}
+}